@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bailey4770/gomazing/cli"
+	"github.com/bailey4770/gomazing/library"
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	textv2 "github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	browserRowHeight = 72
+	browserThumbSize = 64
+	browserPadding   = 8
+	// the browser needs more room than a small maze window gives it
+	browserMinWidth  = 480
+	browserMinHeight = 360
+)
+
+// browser is the in-game list of saved mazes. While it is open it takes over Update and Draw.
+type browser struct {
+	lib      *library.Library
+	entries  []library.Entry
+	thumbs   map[string]*ebiten.Image
+	selected int
+	scroll   int
+	message  string
+	// windowW and windowH are restored when the browser closes
+	windowW, windowH int
+}
+
+func newBrowser() (*browser, error) {
+	saveDir, err := cli.GetSaveDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not get save dir: %v", err)
+	}
+
+	lib, err := library.Open(saveDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not open library: %v", err)
+	}
+
+	b := &browser{
+		lib:     lib,
+		entries: lib.List(library.Filter{}),
+		thumbs:  make(map[string]*ebiten.Image),
+	}
+	if len(b.entries) == 0 {
+		b.message = "No saved mazes yet. Press S after generating to save one."
+	}
+
+	return b, nil
+}
+
+func (g *game) openBrowser() error {
+	b, err := newBrowser()
+	if err != nil {
+		return err
+	}
+	g.browser = b
+
+	b.windowW, b.windowH = ebiten.WindowSize()
+	ebiten.SetWindowSize(max(b.windowW, browserMinWidth), max(b.windowH, browserMinHeight))
+	return nil
+}
+
+func (g *game) closeBrowser() {
+	ebiten.SetWindowSize(g.browser.windowW, g.browser.windowH)
+	g.browser = nil
+}
+
+func (g *game) updateBrowser() error {
+	b := g.browser
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.closeBrowser()
+		return nil
+	}
+
+	if len(b.entries) == 0 {
+		return nil
+	}
+
+	visible := max(1, (g.uiH-browserPadding)/browserRowHeight)
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) || inpututil.IsKeyJustPressed(ebiten.KeyJ) {
+		b.selected = min(b.selected+1, len(b.entries)-1)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) || inpututil.IsKeyJustPressed(ebiten.KeyK) {
+		b.selected = max(b.selected-1, 0)
+	}
+
+	if _, wheelY := ebiten.Wheel(); wheelY != 0 {
+		b.scroll -= int(wheelY)
+		b.scroll = max(0, min(b.scroll, len(b.entries)-visible))
+	} else {
+		// keep the selection on screen when moving with the keyboard
+		if b.selected < b.scroll {
+			b.scroll = b.selected
+		} else if b.selected >= b.scroll+visible {
+			b.scroll = b.selected - visible + 1
+		}
+	}
+
+	load := inpututil.IsKeyJustPressed(ebiten.KeyEnter)
+
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		_, y := g.uiCursor()
+		clicked := b.scroll + (y-browserPadding)/browserRowHeight
+		if y >= browserPadding && clicked < len(b.entries) {
+			// first click selects, clicking the selected maze loads it
+			load = clicked == b.selected
+			b.selected = clicked
+		}
+	}
+
+	if load {
+		entry := b.entries[b.selected]
+		if err := g.loadMaze(b.lib.Path(entry.Name)); err != nil {
+			b.message = fmt.Sprintf("Could not load %s: %v", entry.Name, err)
+			return nil
+		}
+		g.closeBrowser()
+		g.notify("Loaded " + entry.Name)
+	}
+
+	return nil
+}
+
+// loadMaze swaps a saved maze in for whatever is on screen and fits the camera to it
+func (g *game) loadMaze(path string) error {
+	grid, meta, err := mazesave.LoadMaze(path)
+	if err != nil {
+		return err
+	}
+
+	numRows, numCols := len(grid), grid.Cols()
+	tileSize := cli.LoadedTileSize(meta.TileSize, g.cfg.TileSize, g.cfg.WallThickness)
+
+	g.generator = nil
+	g.recorder = nil
+	g.complete = true
+	g.dialog = nil
+	g.play = nil
+	g.board = nil
+	g.controls.iterations = 0
+	g.history = nil
+
+	g.cfg.Generator = nil
+	g.cfg.GeneratorName = meta.Algorithm
+	g.cfg.Seed = meta.Seed
+	g.cfg.Start, g.cfg.Goal = meta.Endpoints(grid)
+	g.cfg.MazePath = path
+	g.cfg.MaxRows, g.cfg.MaxCols, g.cfg.TileSize = numRows, numCols, tileSize
+	g.cfg.Topology = grid.Topology()
+	g.setGrid(grid)
+	g.cam = camera{}
+
+	return nil
+}
+
+func (b *browser) thumbnail(e library.Entry) *ebiten.Image {
+	if img, ok := b.thumbs[e.Name]; ok {
+		return img
+	}
+
+	// cache failures as nil too so a missing file is only tried once
+	b.thumbs[e.Name] = nil
+	if e.Thumbnail == "" {
+		return nil
+	}
+
+	file, err := os.Open(filepath.Join(b.lib.Dir(), e.Thumbnail))
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	decoded, err := png.Decode(file)
+	if err != nil {
+		return nil
+	}
+
+	img := ebiten.NewImageFromImage(decoded)
+	b.thumbs[e.Name] = img
+	return img
+}
+
+func (b *browser) Draw(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{20, 20, 28, 255})
+	width, height := screen.Bounds().Dx(), screen.Bounds().Dy()
+
+	if b.message != "" {
+		drawText(screen, b.message, browserPadding, height-20, color.RGBA{255, 200, 80, 255})
+	}
+
+	for i := b.scroll; i < len(b.entries); i++ {
+		y := browserPadding + (i-b.scroll)*browserRowHeight
+		if y+browserRowHeight > height {
+			break
+		}
+
+		if i == b.selected {
+			vector.FillRect(screen, 0, float32(y), float32(width), browserRowHeight, color.RGBA{50, 60, 90, 255}, false)
+		}
+
+		e := b.entries[i]
+		thumbX, thumbY := float64(browserPadding), float64(y+(browserRowHeight-browserThumbSize)/2)
+		if img := b.thumbnail(e); img != nil {
+			op := &ebiten.DrawImageOptions{}
+			scale := browserThumbSize / float64(max(img.Bounds().Dx(), img.Bounds().Dy()))
+			op.GeoM.Scale(scale, scale)
+			op.GeoM.Translate(thumbX, thumbY)
+			screen.DrawImage(img, op)
+		} else {
+			vector.StrokeRect(screen, float32(thumbX), float32(thumbY), browserThumbSize, browserThumbSize, 1, color.Gray{100}, false)
+		}
+
+		textX := browserPadding*2 + browserThumbSize
+		drawText(screen, e.Name, textX, y+10, color.White)
+
+		details := fmt.Sprintf("%dx%d", e.Rows, e.Cols)
+		if e.Algorithm != "" {
+			details += "  " + e.Algorithm
+		}
+		if !e.Created.IsZero() {
+			details += "  " + e.Created.Local().Format(time.DateTime)
+		}
+		drawText(screen, details, textX, y+30, color.Gray{180})
+
+		if len(e.Tags) > 0 {
+			drawText(screen, fmt.Sprintf("tags: %v", e.Tags), textX, y+48, color.Gray{140})
+		}
+	}
+
+	drawText(screen, "Up/Down select  Enter load  Esc back", width-270, height-20, color.Gray{140})
+}
+
+func drawText(screen *ebiten.Image, msg string, x, y int, clr color.Color) {
+	var opts textv2.DrawOptions
+	opts.GeoM.Translate(float64(x), float64(y))
+	opts.ColorScale.ScaleWithColor(clr)
+	textv2.Draw(screen, msg, uiFace, &opts)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	maxZoom = 8.0
+	// zoomStep is how much one wheel notch or key press zooms
+	zoomStep = 1.2
+	// panSpeed is in logical pixels per tick, so panning feels the same at any zoom
+	panSpeed = 8.0
+	// keep at least this much of the maze on screen when panning, in logical pixels
+	panMargin = 40.0
+	// fitMargin is the gap left around a fitted maze, in logical pixels
+	fitMargin = 16.0
+	// outlineStep is the longest straight piece of a curved tile outline, in physical pixels
+	outlineStep = 4.0
+)
+
+// camera maps world pixels, where a tile is cfg.TileSize across, to physical screen pixels
+type camera struct {
+	// x and y are the world point at the top left of the screen
+	x, y float64
+	zoom float64
+	// follow keeps the player centred in play mode until the user pans away
+	follow bool
+	// fitted keeps the whole maze in view through resizes until the user zooms or pans
+	fitted bool
+
+	dragging     bool
+	dragX, dragY int
+}
+
+// geoM is the world to screen transform
+func (c *camera) geoM() ebiten.GeoM {
+	var m ebiten.GeoM
+	m.Translate(-c.x, -c.y)
+	m.Scale(c.zoom, c.zoom)
+	return m
+}
+
+func (c *camera) toScreen(wx, wy float64) (float32, float32) {
+	return float32((wx - c.x) * c.zoom), float32((wy - c.y) * c.zoom)
+}
+
+func (c *camera) toWorld(sx, sy float64) (float64, float64) {
+	return sx/c.zoom + c.x, sy/c.zoom + c.y
+}
+
+// zoomAt zooms by factor keeping the world point under (sx, sy) where it is on screen
+func (c *camera) zoomAt(factor, sx, sy, lo, hi float64) {
+	wx, wy := c.toWorld(sx, sy)
+	c.zoom = max(lo, min(c.zoom*factor, hi))
+	c.x, c.y = wx-sx/c.zoom, wy-sy/c.zoom
+}
+
+func (c *camera) centreOn(wx, wy, screenW, screenH float64) {
+	c.x = wx - screenW/2/c.zoom
+	c.y = wy - screenH/2/c.zoom
+}
+
+// fit zooms so the whole world fits inside margin, never past maxFit, and centres it
+func (c *camera) fit(worldW, worldH, screenW, screenH, margin, maxFit float64) {
+	c.zoom = min(maxFit, max(1, screenW-2*margin)/worldW, max(1, screenH-2*margin)/worldH)
+	c.centreOn(worldW/2, worldH/2, screenW, screenH)
+	c.fitted = true
+}
+
+// clamp stops the maze being panned entirely off screen
+func (c *camera) clamp(worldW, worldH, screenW, screenH, margin float64) {
+	viewW, viewH := screenW/c.zoom, screenH/c.zoom
+	margin /= c.zoom
+	c.x = max(margin-viewW, min(c.x, worldW-margin))
+	c.y = max(margin-viewH, min(c.y, worldH-margin))
+}
+
+func (g *game) worldSize() (float64, float64) {
+	width, height := g.grid.Topology().Size(g.cfg.MaxRows, g.cfg.MaxCols)
+	size := float64(g.cfg.TileSize)
+	return width * size, height * size
+}
+
+// fitCamera shows the whole maze, centred with a margin. Small mazes are shown at their own tile size
+// in logical pixels rather than stretched to fill the window.
+func (g *game) fitCamera() {
+	worldW, worldH := g.worldSize()
+	g.cam.fit(worldW, worldH, float64(g.screenW), float64(g.screenH), fitMargin*g.scale, g.scale)
+	g.cam.follow = false
+}
+
+// minZoom lets the maze shrink to a quarter of the window but no further
+func (g *game) minZoom() float64 {
+	worldW, worldH := g.worldSize()
+	return min(g.scale, float64(g.screenW)/worldW, float64(g.screenH)/worldH) / 4
+}
+
+func (g *game) maxZoom() float64 {
+	return maxZoom * g.scale
+}
+
+// resize is called from Layout when the window or its monitor changes. A fitted maze is refitted,
+// otherwise the middle of the view stays put and the zoom follows the device scale.
+func (g *game) resize(screenW, screenH int, scale float64) {
+	oldW, oldH, oldScale := float64(g.screenW), float64(g.screenH), g.scale
+	g.screenW, g.screenH, g.scale = screenW, screenH, scale
+
+	if g.cam.zoom == 0 {
+		// not placed yet, Draw fits it
+		return
+	}
+	if g.cam.fitted {
+		g.fitCamera()
+		return
+	}
+
+	wx, wy := g.cam.toWorld(oldW/2, oldH/2)
+	if oldScale > 0 {
+		g.cam.zoom *= scale / oldScale
+	}
+	g.cam.centreOn(wx, wy, float64(screenW), float64(screenH))
+}
+
+// uiCursor is the cursor in logical pixels, which the UI layer is drawn in
+func (g *game) uiCursor() (int, int) {
+	x, y := ebiten.CursorPosition()
+	return int(float64(x) / g.scale), int(float64(y) / g.scale)
+}
+
+// updateCamera handles zooming and panning. Shift+arrows pan since the bare arrows move the
+// player and step through history.
+func (g *game) updateCamera() {
+	c := &g.cam
+	screenW, screenH := float64(g.screenW), float64(g.screenH)
+	if screenW == 0 || screenH == 0 {
+		// Layout has not run yet
+		return
+	}
+
+	if _, wheelY := ebiten.Wheel(); wheelY != 0 {
+		x, y := ebiten.CursorPosition()
+		factor := zoomStep
+		if wheelY < 0 {
+			factor = 1 / zoomStep
+		}
+		c.zoomAt(factor, float64(x), float64(y), g.minZoom(), g.maxZoom())
+		c.fitted = false
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageUp) {
+		c.zoomAt(zoomStep, screenW/2, screenH/2, g.minZoom(), g.maxZoom())
+		c.fitted = false
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageDown) {
+		c.zoomAt(1/zoomStep, screenW/2, screenH/2, g.minZoom(), g.maxZoom())
+		c.fitted = false
+	}
+
+	if ebiten.IsKeyPressed(ebiten.KeyShift) {
+		dx, dy := 0.0, 0.0
+		if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
+			dx -= panSpeed
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
+			dx += panSpeed
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
+			dy -= panSpeed
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
+			dy += panSpeed
+		}
+		if dx != 0 || dy != 0 {
+			c.x += dx * g.scale / c.zoom
+			c.y += dy * g.scale / c.zoom
+			c.follow = false
+			c.fitted = false
+		}
+	}
+
+	g.updateDrag()
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyC) {
+		if g.play != nil {
+			c.follow = true
+		} else {
+			g.fitCamera()
+		}
+	}
+
+	if c.follow && g.play != nil {
+		wx, wy := g.tileCentre(g.play.player)
+		c.centreOn(wx, wy, screenW, screenH)
+	}
+
+	worldW, worldH := g.worldSize()
+	c.clamp(worldW, worldH, screenW, screenH, panMargin*g.scale)
+}
+
+// updateDrag pans with the right or middle mouse button anywhere, or the left one away from the timeline.
+// The editor keeps the left button for itself.
+func (g *game) updateDrag() {
+	c := &g.cam
+	x, y := ebiten.CursorPosition()
+	_, uiY := g.uiCursor()
+
+	for _, button := range []ebiten.MouseButton{ebiten.MouseButtonLeft, ebiten.MouseButtonRight, ebiten.MouseButtonMiddle} {
+		if !inpututil.IsMouseButtonJustPressed(button) {
+			continue
+		}
+		if button == ebiten.MouseButtonLeft && (g.scrubbing || uiY < timelineGrab || g.editor != nil) {
+			continue
+		}
+		c.dragging = true
+		c.dragX, c.dragY = x, y
+	}
+
+	if !c.dragging {
+		return
+	}
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) && !ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) &&
+		!ebiten.IsMouseButtonPressed(ebiten.MouseButtonMiddle) {
+		c.dragging = false
+		return
+	}
+
+	if x != c.dragX || y != c.dragY {
+		c.x -= float64(x-c.dragX) / c.zoom
+		c.y -= float64(y-c.dragY) / c.zoom
+		c.dragX, c.dragY = x, y
+		c.follow = false
+		c.fitted = false
+	}
+}
+
+// tileOrigin is t's top left corner in world pixels
+func (g *game) tileOrigin(t *Tile) (float64, float64) {
+	return float64(t.Col * g.cfg.TileSize), float64(t.Row * g.cfg.TileSize)
+}
+
+func (g *game) tileCentre(t *Tile) (float64, float64) {
+	x, y := g.grid.Topology().Centre(t)
+	size := float64(g.cfg.TileSize)
+	return x * size, y * size
+}
+
+// visibleTiles is the range of rows and cols at least partly on screen, end exclusive. Rows may be shorter than
+// colEnd in polar mazes.
+func (g *game) visibleTiles() (rowStart, rowEnd, colStart, colEnd int) {
+	tileSize := float64(g.cfg.TileSize)
+	left, top := g.cam.toWorld(0, 0)
+	right, bottom := g.cam.toWorld(float64(g.screenW), float64(g.screenH))
+
+	topo := g.grid.Topology()
+	if topo.Shape() == utils.ShapePolar {
+		// rings do not line up with rows and cols on screen
+		return 0, g.cfg.MaxRows, 0, g.cfg.MaxCols
+	}
+	if topo == utils.Square {
+		rowStart = max(0, int(top/tileSize))
+		rowEnd = min(g.cfg.MaxRows, int(bottom/tileSize)+1)
+		colStart = max(0, int(left/tileSize))
+		colEnd = min(g.cfg.MaxCols, int(right/tileSize)+1)
+		return rowStart, rowEnd, colStart, colEnd
+	}
+
+	// Locate can be a tile out either way
+	firstRow, firstCol := topo.Locate(left/tileSize, top/tileSize)
+	lastRow, lastCol := topo.Locate(right/tileSize, bottom/tileSize)
+	rowStart, rowEnd = max(0, firstRow-1), min(g.cfg.MaxRows, lastRow+2)
+	colStart, colEnd = max(0, firstCol-1), min(g.cfg.MaxCols, lastCol+2)
+	return rowStart, rowEnd, colStart, colEnd
+}
+
+// fillTile fills t inset by inset world pixels on each side, skipping tiles off screen
+func (g *game) fillTile(screen *ebiten.Image, t *Tile, inset float64, clr color.Color) {
+	if topo := g.grid.Topology(); topo != utils.Square {
+		g.fillOutline(screen, t, topo, inset, clr)
+		return
+	}
+
+	wx, wy := g.tileOrigin(t)
+	x, y := g.cam.toScreen(wx+inset, wy+inset)
+	size := float32((float64(g.cfg.TileSize) - 2*inset) * g.cam.zoom)
+
+	if x+size < 0 || y+size < 0 || x > float32(g.screenW) || y > float32(g.screenH) {
+		return
+	}
+	vector.FillRect(screen, x, y, size, size, clr, false)
+}
+
+// fillOutline is fillTile for tiles that are not square, shrinking the outline towards the centre
+func (g *game) fillOutline(screen *ebiten.Image, t *Tile, topo utils.Topology, inset float64, clr color.Color) {
+	size := float64(g.cfg.TileSize)
+	cx, cy := topo.Centre(t)
+	// the sides are about half a tile from the centre
+	f := inset / (size / 2)
+
+	// no corner is more than one and a half tiles from the centre, so anything further off screen is skipped
+	x, y := g.cam.toScreen(cx*size, cy*size)
+	reach := float32(1.5 * size * g.cam.zoom)
+	if x+reach < 0 || y+reach < 0 || x-reach > float32(g.screenW) || y-reach > float32(g.screenH) {
+		return
+	}
+
+	// curved sides are followed a few pixels at a time
+	step := max(0.02, outlineStep/(size*g.cam.zoom))
+
+	var path vector.Path
+	for side := range topo.Sides(t) {
+		points := utils.SidePoints(topo, t, side, step)
+		// each side starts where the last one ended
+		for i, p := range points[:len(points)-1] {
+			sx, sy := g.cam.toScreen((p[0]+(cx-p[0])*f)*size, (p[1]+(cy-p[1])*f)*size)
+			if side == 0 && i == 0 {
+				path.MoveTo(sx, sy)
+			} else {
+				path.LineTo(sx, sy)
+			}
+		}
+	}
+	path.Close()
+
+	op := &vector.DrawPathOptions{}
+	op.ColorScale.ScaleWithColor(clr)
+	vector.FillPath(screen, &path, nil, op)
+}
+
+// fillToken draws a round token filling most of t
+func (g *game) fillToken(screen *ebiten.Image, t *Tile, clr color.Color) {
+	x, y := g.cam.toScreen(g.tileCentre(t))
+	radius := float32((float64(g.cfg.TileSize)/2 - float64(g.cfg.WallThickness)) * g.cam.zoom)
+	vector.FillCircle(screen, x, y, max(1, radius), clr, true)
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"github.com/bailey4770/gomazing/theme"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// maxCanvasSize keeps the cached maze within what every GPU can hold. Bigger mazes are cached at a
+	// smaller tile size and scaled up when drawn.
+	maxCanvasSize = 8192
+	// maxBatchQuads bounds the vertex buffer. A full redraw of a huge maze takes a few batches.
+	maxBatchQuads = 1 << 16
+	// capSegments is how many triangles make up each quarter of a round wall cap
+	capSegments = 4
+)
+
+// mazeCanvas caches the maze walls in an offscreen image. Tiles are only redrawn when their walls change,
+// and redraws go out as DrawTriangles batches rather than one DrawImage per wall.
+type mazeCanvas struct {
+	img           *ebiten.Image
+	wallImg       *ebiten.Image
+	grid          Grid
+	topo          utils.Topology
+	tileSize      int
+	wallThickness int
+	scale         float64
+	// wallColour is straight alpha, the DrawTriangles default
+	wallColour [4]float32
+	// roundCaps draws a quarter disc in each tile corner where walls meet or end. Only square mazes have them.
+	roundCaps bool
+
+	full  bool
+	dirty []*Tile
+	// marked stops a tile being queued twice in one frame
+	marked []bool
+
+	vertices []ebiten.Vertex
+	indices  []uint32
+	// blend is how queued quads are drawn, clearing for wiping tiles and normal for walls
+	blend ebiten.Blend
+}
+
+func newMazeCanvas(grid Grid, cfg Config) *mazeCanvas {
+	topo := grid.Topology()
+	width, height := topo.Size(len(grid), grid.Cols())
+
+	tileSize := cfg.TileSize
+	if float64(tileSize)*max(width, height) > maxCanvasSize {
+		tileSize = max(1, int(maxCanvasSize/max(width, height)))
+	}
+	wallThickness := max(1, cfg.WallThickness*tileSize/cfg.TileSize)
+	wall := cfg.Theme.Wall
+
+	return &mazeCanvas{
+		img:           ebiten.NewImage(int(math.Ceil(width*float64(tileSize))), int(math.Ceil(height*float64(tileSize)))),
+		wallImg:       cfg.WallImg,
+		grid:          grid,
+		topo:          topo,
+		tileSize:      tileSize,
+		wallThickness: wallThickness,
+		scale:         float64(cfg.TileSize) / float64(tileSize),
+		wallColour:    [4]float32{float32(wall.R) / 255, float32(wall.G) / 255, float32(wall.B) / 255, float32(wall.A) / 255},
+		roundCaps:     cfg.Theme.Caps == theme.CapsRound && topo == utils.Square,
+		full:          true,
+		blend:         ebiten.BlendSourceOver,
+		marked:        make([]bool, grid.Size()),
+	}
+}
+
+// dispose frees the cached image. The canvas must not be used afterwards.
+func (c *mazeCanvas) dispose() {
+	if c != nil {
+		c.img.Deallocate()
+	}
+}
+
+// invalidate redraws every tile on the next draw
+func (c *mazeCanvas) invalidate() {
+	if c != nil {
+		c.full = true
+	}
+}
+
+// markTile queues t to be redrawn
+func (c *mazeCanvas) markTile(t *Tile) {
+	if c == nil || c.full {
+		return
+	}
+
+	i := c.grid.Index(t)
+	if !c.marked[i] {
+		c.marked[i] = true
+		c.dirty = append(c.dirty, t)
+	}
+}
+
+// markEdge queues both tiles either side of a changed wall. Round caps reach into every tile around
+// the wall's two ends, so those are queued too.
+func (c *mazeCanvas) markEdge(e utils.Edge) {
+	c.markTile(e.A)
+	c.markTile(e.B)
+	if c == nil || !c.roundCaps {
+		return
+	}
+
+	// the corners at each end of the wall, as lattice points
+	row, col := max(e.A.Row, e.B.Row), max(e.A.Col, e.B.Col)
+	if e.A.Row == e.B.Row {
+		c.markCorner(row, col)
+		c.markCorner(row+1, col)
+	} else {
+		c.markCorner(row, col)
+		c.markCorner(row, col+1)
+	}
+}
+
+// markCorner queues the up to four tiles meeting at a lattice point
+func (c *mazeCanvas) markCorner(row, col int) {
+	for _, t := range [4]*Tile{c.at(row-1, col-1), c.at(row-1, col), c.at(row, col-1), c.at(row, col)} {
+		if t != nil {
+			c.markTile(t)
+		}
+	}
+}
+
+// at is the tile at row, col or nil off the grid
+func (c *mazeCanvas) at(row, col int) *Tile {
+	if row < 0 || row >= len(c.grid) || col < 0 || col >= len(c.grid[row]) {
+		return nil
+	}
+	return c.grid[row][col]
+}
+
+// draw brings the cache up to date then draws the part of it cam can see onto screen
+func (c *mazeCanvas) draw(screen *ebiten.Image, cam camera, visible func() (int, int, int, int)) {
+	c.flush()
+
+	rowStart, rowEnd, colStart, colEnd := visible()
+	if rowStart >= rowEnd || colStart >= colEnd {
+		return
+	}
+	src := c.bounds(rowStart, rowEnd, colStart, colEnd)
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(c.scale, c.scale)
+	op.GeoM.Translate(float64(src.Min.X)*c.scale, float64(src.Min.Y)*c.scale)
+	op.GeoM.Concat(cam.geoM())
+	if c.scale*cam.zoom < 1 {
+		// nearest neighbour drops thin walls entirely when shrinking
+		op.Filter = ebiten.FilterLinear
+	}
+	screen.DrawImage(c.img.SubImage(src).(*ebiten.Image), op)
+}
+
+// bounds is the part of the cache covering a range of tiles, end exclusive
+func (c *mazeCanvas) bounds(rowStart, rowEnd, colStart, colEnd int) image.Rectangle {
+	if c.topo == utils.Square {
+		return image.Rect(colStart*c.tileSize, rowStart*c.tileSize, colEnd*c.tileSize, rowEnd*c.tileSize)
+	}
+	if c.topo.Shape() == utils.ShapePolar {
+		// rings do not line up with rows and cols in the image
+		return c.img.Bounds()
+	}
+
+	// rows may be staggered, so take the second row in from each end as well
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, row := range [4]int{rowStart, min(rowStart+1, rowEnd-1), max(rowStart, rowEnd-2), rowEnd - 1} {
+		for _, col := range [2]int{colStart, colEnd - 1} {
+			t := c.grid[row][col]
+			for i := range c.topo.Sides(t) {
+				x, y := c.topo.Corner(t, i)
+				minX, minY, maxX, maxY = min(minX, x), min(minY, y), max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+
+	size := float64(c.tileSize)
+	rect := image.Rect(int(minX*size), int(minY*size), int(math.Ceil(maxX*size)), int(math.Ceil(maxY*size)))
+	return rect.Intersect(c.img.Bounds())
+}
+
+func (c *mazeCanvas) flush() {
+	if c.full {
+		c.img.Clear()
+		for _, row := range c.grid {
+			for _, t := range row {
+				c.addWalls(t)
+			}
+		}
+		c.submit()
+
+		c.full = false
+		c.clearDirty()
+		return
+	}
+
+	if len(c.dirty) == 0 {
+		return
+	}
+
+	// wipe the dirty tiles in one batch, then draw their walls in another
+	c.blend = ebiten.BlendClear
+	for _, t := range c.dirty {
+		if c.topo == utils.Square {
+			x, y := c.origin(t)
+			c.addQuad(x, y, c.tileSize, c.tileSize)
+		} else {
+			c.addOutline(t)
+		}
+	}
+	c.submit()
+
+	c.blend = ebiten.BlendSourceOver
+	for _, t := range c.dirty {
+		c.addWalls(t)
+	}
+	c.submit()
+
+	c.clearDirty()
+}
+
+func (c *mazeCanvas) clearDirty() {
+	for _, t := range c.dirty {
+		c.marked[c.grid.Index(t)] = false
+	}
+	c.dirty = c.dirty[:0]
+}
+
+// origin is the top left pixel of t in the cache, which may use a smaller tile size than the window
+func (c *mazeCanvas) origin(t *Tile) (int, int) {
+	return t.Col * c.tileSize, t.Row * c.tileSize
+}
+
+// addWalls queues t's walls. Each tile draws its walls inside its own square, so redrawing one tile
+// never touches its neighbours.
+func (c *mazeCanvas) addWalls(t *Tile) {
+	if c.topo != utils.Square {
+		c.addSideWalls(t)
+		return
+	}
+
+	x, y := c.origin(t)
+	size, thick := c.tileSize, c.wallThickness
+
+	if t.Wall(utils.North) {
+		c.addQuad(x, y, size, thick)
+	}
+	if t.Wall(utils.South) {
+		c.addQuad(x, y+size-thick, size, thick)
+	}
+	if t.Wall(utils.West) {
+		c.addQuad(x, y, thick, size)
+	}
+	if t.Wall(utils.East) {
+		c.addQuad(x+size-thick, y, thick, size)
+	}
+
+	if c.roundCaps {
+		for _, corner := range [4][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}} {
+			if c.cornerWalled(t.Row+corner[0], t.Col+corner[1]) {
+				c.addQuarterDisc(t, corner[0], corner[1])
+			}
+		}
+	}
+}
+
+// cornerWalled reports whether any wall touches a lattice point. Walls inside a tile already cover its
+// corner, so the quarter discs only show where a wall ends or turns.
+func (c *mazeCanvas) cornerWalled(row, col int) bool {
+	wall := func(t *Tile, side func(*Tile) bool, other *Tile, otherSide func(*Tile) bool) bool {
+		if t != nil {
+			return side(t)
+		}
+		return other != nil && otherSide(other)
+	}
+	north := func(t *Tile) bool { return t.Wall(utils.North) }
+	south := func(t *Tile) bool { return t.Wall(utils.South) }
+	east := func(t *Tile) bool { return t.Wall(utils.East) }
+	west := func(t *Tile) bool { return t.Wall(utils.West) }
+
+	nw, ne, sw, se := c.at(row-1, col-1), c.at(row-1, col), c.at(row, col-1), c.at(row, col)
+	return wall(sw, north, nw, south) || wall(se, north, ne, south) ||
+		wall(ne, west, nw, east) || wall(se, west, sw, east)
+}
+
+// addQuarterDisc queues the part of a wall thick disc around one of t's corners that lies inside t
+func (c *mazeCanvas) addQuarterDisc(t *Tile, cornerRow, cornerCol int) {
+	if len(c.vertices)/4 >= maxBatchQuads {
+		c.submit()
+	}
+
+	cx, cy := float32((t.Col+cornerCol)*c.tileSize), float32((t.Row+cornerRow)*c.tileSize)
+	// point the quarter back into the tile
+	dx, dy := float32(1-2*cornerCol), float32(1-2*cornerRow)
+	radius := float32(c.wallThickness)
+
+	base := uint32(len(c.vertices))
+	c.vertices = append(c.vertices, c.vertex(cx, cy, 0, 0))
+	for i := range capSegments + 1 {
+		angle := float64(i) * math.Pi / 2 / capSegments
+		x := cx + dx*radius*float32(math.Cos(angle))
+		y := cy + dy*radius*float32(math.Sin(angle))
+		c.vertices = append(c.vertices, c.vertex(x, y, 0, 0))
+	}
+	for i := range uint32(capSegments) {
+		c.indices = append(c.indices, base, base+1+i, base+2+i)
+	}
+}
+
+// sidePoints runs along side of t in cache pixels
+func (c *mazeCanvas) sidePoints(t *Tile, side int) [][2]float32 {
+	size := float64(c.tileSize)
+	points := utils.SidePoints(c.topo, t, side, outlineStep/size)
+
+	scaled := make([][2]float32, len(points))
+	for i, p := range points {
+		scaled[i] = [2]float32{float32(p[0] * size), float32(p[1] * size)}
+	}
+	return scaled
+}
+
+// addSideWalls queues a wall along the inside of each of t's walled sides. Like square tiles, each tile
+// only draws inside its own outline.
+func (c *mazeCanvas) addSideWalls(t *Tile) {
+	thick := float32(c.wallThickness)
+	for side := range c.topo.Sides(t) {
+		if !t.Wall(side) {
+			continue
+		}
+
+		points := c.sidePoints(t, side)
+		// outlines go clockwise, so the inside is on the right of every side
+		normals := make([][2]float32, len(points)-1)
+		for i := range normals {
+			dx, dy := points[i+1][0]-points[i][0], points[i+1][1]-points[i][1]
+			length := float32(math.Hypot(float64(dx), float64(dy)))
+			if length > 0 {
+				normals[i] = [2]float32{-dy / length, dx / length}
+			}
+		}
+
+		base := uint32(len(c.vertices))
+		for i, p := range points {
+			// bends share the offset of the pieces either side, so curves have no gaps
+			n := normals[min(i, len(normals)-1)]
+			if i > 0 && i < len(normals) {
+				prev := normals[i-1]
+				n = [2]float32{(n[0] + prev[0]) / 2, (n[1] + prev[1]) / 2}
+			}
+			c.vertices = append(c.vertices, c.vertex(p[0], p[1], 0, 0), c.vertex(p[0]+n[0]*thick, p[1]+n[1]*thick, 0, 1))
+		}
+		for i := range uint32(len(normals)) {
+			a := base + 2*i
+			c.indices = append(c.indices, a, a+2, a+1, a+2, a+3, a+1)
+		}
+
+		if len(c.vertices)/4 >= maxBatchQuads {
+			c.submit()
+		}
+	}
+}
+
+// addOutline queues t's whole outline as a fan round its centre, for wiping it
+func (c *mazeCanvas) addOutline(t *Tile) {
+	size := float64(c.tileSize)
+	cx, cy := c.topo.Centre(t)
+
+	base := uint32(len(c.vertices))
+	c.vertices = append(c.vertices, c.vertex(float32(cx*size), float32(cy*size), 0, 0))
+	for side := range c.topo.Sides(t) {
+		points := c.sidePoints(t, side)
+		// each side starts where the last one ended
+		for _, p := range points[:len(points)-1] {
+			c.vertices = append(c.vertices, c.vertex(p[0], p[1], 0, 0))
+		}
+	}
+
+	last := uint32(len(c.vertices)) - base - 1
+	for i := range last {
+		c.indices = append(c.indices, base, base+1+i, base+1+(i+1)%last)
+	}
+
+	if len(c.vertices)/4 >= maxBatchQuads {
+		c.submit()
+	}
+}
+
+func (c *mazeCanvas) addQuad(x, y, width, height int) {
+	if len(c.vertices)/4 == maxBatchQuads {
+		c.submit()
+	}
+
+	x0, y0 := float32(x), float32(y)
+	x1, y1 := float32(x+width), float32(y+height)
+	base := uint32(len(c.vertices))
+
+	c.vertices = append(c.vertices,
+		c.vertex(x0, y0, 0, 0),
+		c.vertex(x1, y0, 1, 0),
+		c.vertex(x0, y1, 0, 1),
+		c.vertex(x1, y1, 1, 1),
+	)
+	c.indices = append(c.indices, base, base+1, base+2, base+1, base+3, base+2)
+}
+
+func (c *mazeCanvas) vertex(x, y, srcX, srcY float32) ebiten.Vertex {
+	clr := c.wallColour
+	return ebiten.Vertex{DstX: x, DstY: y, SrcX: srcX, SrcY: srcY, ColorR: clr[0], ColorG: clr[1], ColorB: clr[2], ColorA: clr[3]}
+}
+
+// submit draws the queued quads in one call
+func (c *mazeCanvas) submit() {
+	if len(c.indices) == 0 {
+		return
+	}
+
+	op := &ebiten.DrawTrianglesOptions{Blend: c.blend}
+	src := c.wallImg.SubImage(image.Rect(0, 0, 1, 1)).(*ebiten.Image)
+	c.img.DrawTriangles32(c.vertices, c.indices, src, op)
+
+	c.vertices = c.vertices[:0]
+	c.indices = c.indices[:0]
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/bailey4770/gomazing/generators/prims"
+	"github.com/bailey4770/gomazing/theme"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/bailey4770/gomazing/utils/mazetest"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Drawing needs a graphics context, so TestMain runs the tests from inside an ebiten game loop.
+// That needs a display: on a headless machine use something like xvfb-run go test -bench Draw.
+type testGame struct {
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (g *testGame) Update() error {
+	select {
+	case <-g.started:
+	default:
+		close(g.started)
+	}
+
+	select {
+	case <-g.done:
+		return ebiten.Termination
+	default:
+		return nil
+	}
+}
+
+func (g *testGame) Draw(*ebiten.Image) {}
+
+func (g *testGame) Layout(int, int) (int, int) {
+	return 1, 1
+}
+
+func TestMain(m *testing.M) {
+	g := &testGame{started: make(chan struct{}), done: make(chan struct{})}
+
+	code := 0
+	go func() {
+		<-g.started
+		code = m.Run()
+		close(g.done)
+	}()
+
+	if err := ebiten.RunGameWithOptions(g, &ebiten.RunGameOptions{InitUnfocused: true}); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(code)
+}
+
+const (
+	benchSize     = 500
+	benchTileSize = 2
+)
+
+func benchConfig() Config {
+	wallImg := ebiten.NewImage(1, 1)
+	wallImg.Fill(color.White)
+
+	return Config{
+		TileSize:      benchTileSize,
+		WallThickness: 1,
+		MaxRows:       benchSize,
+		MaxCols:       benchSize,
+		WallImg:       wallImg,
+		Theme:         theme.Default(),
+	}
+}
+
+func benchMaze(b *testing.B) Grid {
+	b.Helper()
+
+	utils.Seed(1)
+	grid := utils.NewGrid(benchSize, benchSize)
+	mazetest.Generate(b, prims.GetMazeState(), grid)
+
+	return grid
+}
+
+var benchCamera = camera{zoom: 1}
+
+func allTiles() (int, int, int, int) {
+	return 0, benchSize, 0, benchSize
+}
+
+// frame draws onto screen and waits for the GPU, so each op is one whole frame
+func frame(screen *ebiten.Image, draw func()) {
+	screen.Clear()
+	draw()
+	_ = screen.At(0, 0)
+}
+
+// BenchmarkDrawPerWall is the old renderer, one DrawImage per wall every frame, kept for comparison
+func BenchmarkDrawPerWall(b *testing.B) {
+	cfg, grid := benchConfig(), benchMaze(b)
+	screen := ebiten.NewImage(benchSize*benchTileSize, benchSize*benchTileSize)
+
+	wall := func(x, y, width, height int) {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(float64(width), float64(height))
+		op.GeoM.Translate(float64(x), float64(y))
+		screen.DrawImage(cfg.WallImg, op)
+	}
+
+	for b.Loop() {
+		frame(screen, func() {
+			for _, row := range grid {
+				for _, t := range row {
+					x, y := t.Col*benchTileSize, t.Row*benchTileSize
+					if t.Wall(utils.North) {
+						wall(x, y, benchTileSize, 1)
+					}
+					if t.Wall(utils.South) {
+						wall(x, y+benchTileSize-1, benchTileSize, 1)
+					}
+					if t.Wall(utils.West) {
+						wall(x, y, 1, benchTileSize)
+					}
+					if t.Wall(utils.East) {
+						wall(x+benchTileSize-1, y, 1, benchTileSize)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDrawFull rebuilds the whole cache every frame, the cost of loading or restarting a maze
+func BenchmarkDrawFull(b *testing.B) {
+	cfg, grid := benchConfig(), benchMaze(b)
+	screen := ebiten.NewImage(benchSize*benchTileSize, benchSize*benchTileSize)
+	canvas := newMazeCanvas(grid, cfg)
+	defer canvas.dispose()
+
+	for b.Loop() {
+		canvas.invalidate()
+		frame(screen, func() { canvas.draw(screen, benchCamera, allTiles) })
+	}
+}
+
+// BenchmarkDrawIncremental changes one wall a frame, as happens while generating
+func BenchmarkDrawIncremental(b *testing.B) {
+	cfg, grid := benchConfig(), benchMaze(b)
+	screen := ebiten.NewImage(benchSize*benchTileSize, benchSize*benchTileSize)
+	canvas := newMazeCanvas(grid, cfg)
+	defer canvas.dispose()
+	canvas.draw(screen, benchCamera, allTiles)
+
+	i := 0
+	for b.Loop() {
+		t := grid.At(i % (grid.Size() - 1))
+		if t.Col < benchSize-1 {
+			next := grid[t.Row][t.Col+1]
+			if t.Wall(utils.East) {
+				utils.RemoveWalls(t, next)
+			} else {
+				utils.AddWalls(t, next)
+			}
+			canvas.markEdge(utils.Edge{A: t, B: next})
+		}
+		i++
+
+		frame(screen, func() { canvas.draw(screen, benchCamera, allTiles) })
+	}
+}
+
+// BenchmarkDrawCached is a frame where nothing changed
+func BenchmarkDrawCached(b *testing.B) {
+	cfg, grid := benchConfig(), benchMaze(b)
+	screen := ebiten.NewImage(benchSize*benchTileSize, benchSize*benchTileSize)
+	canvas := newMazeCanvas(grid, cfg)
+	defer canvas.dispose()
+	canvas.draw(screen, benchCamera, allTiles)
+
+	for b.Loop() {
+		frame(screen, func() { canvas.draw(screen, benchCamera, allTiles) })
+	}
+}
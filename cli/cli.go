@@ -6,13 +6,19 @@ import (
 	"fmt"
 	"image/color"
 	"log"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/bailey4770/gomazing/generators/dfs"
 	"github.com/bailey4770/gomazing/generators/kruskals"
 	"github.com/bailey4770/gomazing/generators/prims"
+	"github.com/bailey4770/gomazing/mazeexport"
 	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/bailey4770/gomazing/theme"
 	"github.com/bailey4770/gomazing/utils"
 	"github.com/hajimehoshi/ebiten/v2"
 )
@@ -23,8 +29,28 @@ type Generator interface {
 	IsComplete() bool
 }
 
+// ChangeReporter is optionally implemented by a Generator to list the walls its last Iterate removed.
+// Generation can only be rewound with generators that implement it.
+type ChangeReporter interface {
+	Changes() []utils.Edge
+}
+
+// Inspector is optionally implemented by a Generator to expose its working state for drawing
+type Inspector interface {
+	Inspect() utils.Inspection
+}
+
 type Config struct {
-	Generator     Generator
+	Generator Generator
+	// Grid is only set when a maze was loaded from file
+	Grid utils.Grid
+	// Topology is how tiles fit together, square, hex or polar
+	Topology      utils.Topology
+	GeneratorName string
+	Seed          int64
+	// Start and Goal are where play mode begins and ends
+	Start         mazesave.Position
+	Goal          mazesave.Position
 	WindowWidth   int
 	WindowHeight  int
 	TileSize      int
@@ -35,35 +61,96 @@ type Config struct {
 	// size of *ebiten.Image == 8 == size of int
 	WallImg   *ebiten.Image
 	ShowStats bool
+	Compress  bool
 	MazePath  string
+	SVGPath   string
+	SVGPage   mazeexport.PageSize
+	// SVGSolution draws the route from start to goal over the exported maze
+	SVGSolution bool
+	// RecordPath is empty unless generation should be recorded to a gif
+	RecordPath string
+	RecordOpts mazeexport.GIFOptions
+	// Fog starts play mode with only tiles the player can see drawn, FogRadius steps around them
+	Fog       bool
+	FogRadius int
+	Theme     theme.Theme
+	// ThemeExports is set when a theme was asked for. Otherwise svg exports keep their print friendly black on white.
+	ThemeExports bool
 }
 
+const (
+	MaxWindowWidth  = 1280
+	MaxWindowHeight = 800
+)
+
 func GetConfig() (Config, error) {
-	var generatorName, mazeName string
-	var numRows, numCols, tileSize, wallThickness, gameSpeed int
-	var showStats bool
+	var generatorName, mazeName, svgPath, pageName, recordPath, paletteName, themeName, topologyName string
+	var numRows, numCols, tileSize, wallThickness, gameSpeed, recordStride, recordDelay int
+	var seed int64
+	var fogRadius int
+	var showStats, compress, fog, svgSolution bool
 
 	generators := GetGenerators()
-	generatorUsage := fmt.Sprintf("Mutually exclusive with load. Input maze generation algorithm %v", getGeneratorNames(generators))
+	generatorUsage := fmt.Sprintf("Mutually exclusive with load. Input maze generation algorithm %v", getNames(generators))
 	flag.StringVar(&generatorName, "gen", "prims", generatorUsage)
 
-	mazeNames, err := getSavedMazes()
-	if err != nil {
-		return Config{}, fmt.Errorf("could not list saved mazes: %v", err)
-	}
+	flag.StringVar(&mazeName, "load", "", "Mutually exclusive with gen. Load a saved maze by name. See 'gomazing lib list'")
 
-	loadUsage := fmt.Sprintf("Mutually exclusive with gen. Load a saved maze from file %v", mazeNames)
-	flag.StringVar(&mazeName, "load", "", loadUsage)
+	topologies := utils.GetTopologies()
+	topologyUsage := fmt.Sprintf("Shape of the tiles %v. Ignored when loading, mazes remember their own", getNames(topologies))
+	flag.StringVar(&topologyName, "topology", "square", topologyUsage)
 
-	flag.IntVar(&numRows, "rows", 24, "Input number of rows")
-	flag.IntVar(&numCols, "cols", 32, "Input number of cols")
+	flag.IntVar(&numRows, "rows", 24, "Input number of rows, or rings for polar mazes")
+	flag.IntVar(&numCols, "cols", 32, "Input number of cols. Ignored for polar mazes")
 	flag.IntVar(&tileSize, "tile", 20, "Input desired size of each tile")
 	flag.IntVar(&wallThickness, "wall", 1, "Input cell wall thickness")
 	flag.IntVar(&gameSpeed, "speed", 3, "Input game speed")
+	flag.Int64Var(&seed, "seed", 0, "Seed for reproducible mazes. Random if not set")
 
 	flag.BoolVar(&showStats, "debug", false, "Show FPS and TPS info")
+	flag.BoolVar(&compress, "compress", false, "Compress walls when saving .maze files")
+	flag.BoolVar(&fog, "fog", false, "Start play mode with fog of war. Toggle with F while playing")
+	flag.IntVar(&fogRadius, "fog-radius", 3, "Number of steps the player can see around corners in fog of war")
+
+	flag.StringVar(&svgPath, "svg", "", "Export the maze as SVG to this path once it is complete")
+	pageSizes := mazeexport.GetPageSizes()
+	pageUsage := fmt.Sprintf("Page size to fit SVG export to %v", getNames(pageSizes))
+	flag.StringVar(&pageName, "page", "none", pageUsage)
+	flag.BoolVar(&svgSolution, "svg-solution", false, "Draw the route from start to goal in the SVG export")
+
+	flag.StringVar(&recordPath, "record", "", "Record maze generation as an animated gif to this path")
+	flag.IntVar(&recordStride, "record-stride", 10, "Number of iterations between recorded frames")
+	flag.IntVar(&recordDelay, "record-delay", 2, "Delay between recorded frames in hundredths of a second")
+	palettes := mazeexport.GetPalettes()
+	paletteUsage := fmt.Sprintf("Colour palette for recorded gif %v", getNames(palettes))
+	flag.StringVar(&paletteName, "record-palette", "", paletteUsage+". Defaults to the theme's colours")
+
+	themeUsage := fmt.Sprintf("Colour theme %v, or the path to a theme file", getNames(theme.GetThemes()))
+	flag.StringVar(&themeName, "theme", "", themeUsage)
 	flag.Parse()
 
+	page, ok := pageSizes[pageName]
+	if !ok {
+		return Config{}, fmt.Errorf("unknown page size %s", pageName)
+	}
+
+	th := theme.Default()
+	if themeName != "" {
+		var err error
+		th, err = theme.Get(themeName)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not get theme: %v", err)
+		}
+	}
+
+	palette := mazeexport.ThemePalette(th)
+	if paletteName != "" {
+		palette, ok = palettes[paletteName]
+		if !ok {
+			return Config{}, fmt.Errorf("unknown palette %s", paletteName)
+		}
+	}
+
 	wallImg := ebiten.NewImage(1, 1)
 	wallImg.Fill(color.White)
 
@@ -73,35 +160,96 @@ func GetConfig() (Config, error) {
 	}
 
 	mazePath := filepath.Join(saveDir, mazeName)
-	loadFlagged := checkFlags(mazePath)
+	loadFlagged, seedFlagged := checkFlags(mazePath)
+	if !seedFlagged {
+		seed = time.Now().UnixNano()
+	}
+
+	topology, ok := topologies[topologyName]
+	if !ok {
+		return Config{}, fmt.Errorf("unknown topology %s", topologyName)
+	}
 
 	var generator Generator
+	var loadedGrid utils.Grid
+	var start, goal mazesave.Position
 	if !loadFlagged {
-		generator = generators[generatorName]
+		generator, ok = generators[generatorName]
+		if !ok {
+			return Config{}, fmt.Errorf("unknown generator %s", generatorName)
+		}
 	} else {
 		generator = nil
 
+		var meta mazesave.Meta
 		var err error
-		numRows, numCols, tileSize, err = mazesave.GetMazeDimensions(mazePath)
+		loadedGrid, meta, err = mazesave.LoadMaze(mazePath)
 		if err != nil {
-			return Config{}, fmt.Errorf("could not load maze dimensions from file: %v", err)
+			return Config{}, fmt.Errorf("could not load maze from file: %v", err)
 		}
+		numRows, numCols = len(loadedGrid), loadedGrid.Cols()
+		tileSize = LoadedTileSize(meta.TileSize, tileSize, wallThickness)
+		topology = loadedGrid.Topology()
+		generatorName, seed = meta.Algorithm, meta.Seed
+		start, goal = meta.Endpoints(loadedGrid)
 	}
 
-	windowHeight, windowWidth := getWindowDimensions(numRows, numCols, tileSize)
+	if !loadFlagged && topology.Shape() == utils.ShapePolar {
+		// polar mazes are a number of rings, and the outer ring fixes the cols
+		if numRows < 1 || numRows > utils.MaxRings {
+			return Config{}, fmt.Errorf("polar mazes need between 1 and %d rings but got %d", utils.MaxRings, numRows)
+		}
+		numCols = topology.Cols(numRows-1, numCols)
+	}
+
+	if err := validateSizes(numRows, numCols, tileSize, wallThickness, gameSpeed); err != nil {
+		return Config{}, err
+	}
+	if fogRadius < 0 {
+		return Config{}, fmt.Errorf("fog radius cannot be negative but got %d", fogRadius)
+	}
+
+	if !loadFlagged {
+		goal = mazesave.Position{Row: numRows - 1, Col: numCols - 1}
+	}
+
+	windowHeight, windowWidth := GetWindowDimensions(topology, numRows, numCols, tileSize)
+
+	recordOpts := mazeexport.DefaultGIFOptions()
+	recordOpts.Stride = recordStride
+	recordOpts.Delay = recordDelay
+	recordOpts.Palette = palette
+	recordOpts.CellSize = tileSize
+	recordOpts.WallThickness = wallThickness
 
 	return Config{
 		Generator:     generator,
+		Grid:          loadedGrid,
+		Topology:      topology,
+		GeneratorName: generatorName,
+		Seed:          seed,
+		Fog:           fog,
+		FogRadius:     fogRadius,
+		Start:         start,
+		Goal:          goal,
 		WindowWidth:   windowWidth,
 		WindowHeight:  windowHeight,
-		TileSize:      windowHeight / numRows,
+		TileSize:      tileSize,
 		WallThickness: wallThickness,
 		MaxRows:       numRows,
 		MaxCols:       numCols,
 		Speed:         gameSpeed,
 		WallImg:       wallImg,
 		ShowStats:     showStats,
+		Compress:      compress,
 		MazePath:      mazePath,
+		SVGPath:       svgPath,
+		SVGPage:       page,
+		SVGSolution:   svgSolution,
+		RecordPath:    recordPath,
+		RecordOpts:    recordOpts,
+		Theme:         th,
+		ThemeExports:  themeName != "",
 	}, nil
 }
 
@@ -124,13 +272,43 @@ func GetSaveDir() (string, error) {
 	return saveDir, nil
 }
 
-func getWindowDimensions(numRows, numCols, tileSize int) (int, int) {
-	return numRows * tileSize, numCols * tileSize
+func validateSizes(numRows, numCols, tileSize, wallThickness, gameSpeed int) error {
+	if err := mazesave.ValidateDimensions(numRows, numCols, tileSize); err != nil {
+		return err
+	}
+	if tileSize < 1 {
+		return fmt.Errorf("tile size must be at least 1 but got %d", tileSize)
+	}
+	if wallThickness < 1 || wallThickness >= tileSize {
+		return fmt.Errorf("wall thickness must be between 1 and %d but got %d", tileSize-1, wallThickness)
+	}
+	if gameSpeed < 1 {
+		return fmt.Errorf("speed must be at least 1 but got %d", gameSpeed)
+	}
+
+	return nil
+}
+
+// LoadedTileSize picks the tile size to show a saved maze at. Files may have no tile size or one too small
+// for the walls, such as mazes made by other tools, and those are shown at the configured size instead.
+func LoadedTileSize(saved, configured, wallThickness int) int {
+	if saved <= wallThickness {
+		return configured
+	}
+	return saved
+}
+
+// GetWindowDimensions returns the window height and width for a maze. Mazes bigger than
+// MaxWindowWidth x MaxWindowHeight get a window of that size and are viewed through the camera.
+func GetWindowDimensions(topo utils.Topology, numRows, numCols, tileSize int) (int, int) {
+	width, height := topo.Size(numRows, numCols)
+	return min(int(math.Ceil(height*float64(tileSize))), MaxWindowHeight), min(int(math.Ceil(width*float64(tileSize))), MaxWindowWidth)
 }
 
-func checkFlags(mazePath string) bool {
+func checkFlags(mazePath string) (bool, bool) {
 	loadFlagged := false
 	genFlagged := false
+	seedFlagged := false
 
 	flag.Visit(func(f *flag.Flag) {
 		switch f.Name {
@@ -142,6 +320,9 @@ func checkFlags(mazePath string) bool {
 
 		case "gen":
 			genFlagged = true
+
+		case "seed":
+			seedFlagged = true
 		}
 	})
 
@@ -149,7 +330,7 @@ func checkFlags(mazePath string) bool {
 		log.Fatal("Error: cannot gen and load a maze. Commands are mutually exclusive.")
 	}
 
-	return loadFlagged
+	return loadFlagged, seedFlagged
 }
 
 func GetGenerators() map[string]Generator {
@@ -160,29 +341,7 @@ func GetGenerators() map[string]Generator {
 	}
 }
 
-func getGeneratorNames(generators map[string]Generator) []string {
-	var names []string
-	for name := range generators {
-		names = append(names, name)
-	}
-	return names
-}
-
-func getSavedMazes() ([]string, error) {
-	saveDir, err := GetSaveDir()
-	if err != nil {
-		return []string{}, err
-	}
-
-	mazes, err := os.ReadDir(saveDir)
-	if err != nil {
-		return []string{}, fmt.Errorf("could not read dir %s: %v", saveDir, err)
-	}
-
-	var mazeNames []string
-	for _, maze := range mazes {
-		mazeNames = append(mazeNames, maze.Name())
-	}
-
-	return mazeNames, nil
+// getNames lists the keys of m in order, so usage text reads the same every run
+func getNames[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
 }
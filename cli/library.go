@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bailey4770/gomazing/library"
+)
+
+const libraryUsage = `usage: gomazing lib <command> [args]
+
+commands:
+  list [-algo name] [-tag tag] [-min-rows n] [-max-rows n] [-min-cols n] [-max-cols n] [-since YYYY-MM-DD]
+  search <query>
+  rename <name> <new name>
+  delete <name>
+  duplicate <name> <new name>
+  import <path> [name]
+  export <name> <path>
+  tag <name> <tag>...
+  untag <name> <tag>...`
+
+// RunLibrary handles "gomazing lib ..." commands for managing the save directory
+func RunLibrary(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(libraryUsage)
+	}
+
+	saveDir, err := GetSaveDir()
+	if err != nil {
+		return fmt.Errorf("could not get save dir: %v", err)
+	}
+
+	lib, err := library.Open(saveDir)
+	if err != nil {
+		return fmt.Errorf("could not open library: %v", err)
+	}
+
+	command, args := args[0], args[1:]
+
+	// expect checks the number of positional args for commands that take no flags
+	expect := func(lo, hi int) error {
+		if len(args) < lo || len(args) > hi {
+			return fmt.Errorf("wrong number of arguments for %s\n%s", command, libraryUsage)
+		}
+		return nil
+	}
+
+	switch command {
+	case "list":
+		filter, err := parseListFlags(args)
+		if err != nil {
+			return err
+		}
+		return printEntries(out, lib.List(filter))
+
+	case "search":
+		if err := expect(1, 1); err != nil {
+			return err
+		}
+		return printEntries(out, lib.Search(args[0]))
+
+	case "rename":
+		if err := expect(2, 2); err != nil {
+			return err
+		}
+		return lib.Rename(args[0], args[1])
+
+	case "delete":
+		if err := expect(1, 1); err != nil {
+			return err
+		}
+		return lib.Delete(args[0])
+
+	case "duplicate":
+		if err := expect(2, 2); err != nil {
+			return err
+		}
+		return lib.Duplicate(args[0], args[1])
+
+	case "import":
+		if err := expect(1, 2); err != nil {
+			return err
+		}
+		name := ""
+		if len(args) == 2 {
+			name = args[1]
+		}
+		return lib.Import(args[0], name)
+
+	case "export":
+		if err := expect(2, 2); err != nil {
+			return err
+		}
+		return lib.Export(args[0], args[1])
+
+	case "tag":
+		if err := expect(2, len(args)); err != nil {
+			return err
+		}
+		return lib.AddTags(args[0], args[1:]...)
+
+	case "untag":
+		if err := expect(2, len(args)); err != nil {
+			return err
+		}
+		return lib.RemoveTags(args[0], args[1:]...)
+	}
+
+	return fmt.Errorf("unknown command %s\n%s", command, libraryUsage)
+}
+
+func parseListFlags(args []string) (library.Filter, error) {
+	var filter library.Filter
+	var since string
+
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.StringVar(&filter.Algorithm, "algo", "", "Only mazes made by this algorithm")
+	fs.StringVar(&filter.Tag, "tag", "", "Only mazes with this tag")
+	fs.IntVar(&filter.MinRows, "min-rows", 0, "Minimum number of rows")
+	fs.IntVar(&filter.MaxRows, "max-rows", 0, "Maximum number of rows")
+	fs.IntVar(&filter.MinCols, "min-cols", 0, "Minimum number of cols")
+	fs.IntVar(&filter.MaxCols, "max-cols", 0, "Maximum number of cols")
+	fs.StringVar(&since, "since", "", "Only mazes created on or after this date (YYYY-MM-DD)")
+
+	if err := fs.Parse(args); err != nil {
+		return library.Filter{}, err
+	}
+	if fs.NArg() > 0 {
+		return library.Filter{}, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	if since != "" {
+		var err error
+		if filter.Since, err = time.Parse(time.DateOnly, since); err != nil {
+			return library.Filter{}, fmt.Errorf("bad -since date: %v", err)
+		}
+	}
+
+	return filter, nil
+}
+
+func printEntries(out io.Writer, entries []library.Entry) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tALGORITHM\tCREATED\tTAGS")
+
+	for _, e := range entries {
+		created := "-"
+		if !e.Created.IsZero() {
+			created = e.Created.Local().Format(time.DateTime)
+		}
+		algorithm := e.Algorithm
+		if algorithm == "" {
+			algorithm = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%dx%d\t%s\t%s\t%s\n", e.Name, e.Rows, e.Cols, algorithm, created, strings.Join(e.Tags, ","))
+	}
+
+	return tw.Flush()
+}
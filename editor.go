@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// editGrab is how close to a wall a click has to be to toggle it, as a fraction of the tile size.
+// Clicks further in start carving instead.
+const editGrab = 0.25
+
+type editKind int
+
+const (
+	editWall editKind = iota
+	editStart
+	editGoal
+)
+
+// editOp is one change made by the editor. Wall ops flip the wall on edge, which is its own inverse.
+// Start and goal ops move the marker from one tile to another.
+type editOp struct {
+	kind     editKind
+	edge     utils.Edge
+	from, to mazesave.Position
+}
+
+// editor hand edits a finished maze. Each undo entry holds everything one click or drag changed,
+// so a long carve undoes in one go.
+type editor struct {
+	undo, redo [][]editOp
+	// action gathers the ops of the click or drag in progress
+	action  []editOp
+	carving bool
+	last    *Tile
+	// validity is worked out again after each edit, checked says it is up to date
+	validity utils.Validity
+	checked  bool
+}
+
+func (g *game) startEditor() {
+	g.seekToHead()
+	g.editor = &editor{validity: utils.Validate(g.grid), checked: true}
+}
+
+func (g *game) updateEditor() error {
+	e := g.editor
+	ctrl := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape), inpututil.IsKeyJustPressed(ebiten.KeyE):
+		g.editor = nil
+		return nil
+	case inpututil.IsKeyJustPressed(ebiten.KeyP):
+		g.editor = nil
+		g.startPlay(g.cfg.Fog)
+		return nil
+	case ctrl && inpututil.IsKeyJustPressed(ebiten.KeyZ) && ebiten.IsKeyPressed(ebiten.KeyShift),
+		ctrl && inpututil.IsKeyJustPressed(ebiten.KeyY):
+		g.redoEdit()
+	case ctrl && inpututil.IsKeyJustPressed(ebiten.KeyZ):
+		g.undoEdit()
+	case inpututil.IsKeyJustPressed(ebiten.KeyS):
+		g.openSaveDialog()
+		return nil
+	case inpututil.IsKeyJustPressed(ebiten.Key1):
+		g.moveMarker(editStart)
+	case inpututil.IsKeyJustPressed(ebiten.Key2):
+		g.moveMarker(editGoal)
+	}
+
+	g.updateCarving()
+
+	if !e.checked {
+		was := e.validity
+		e.validity = utils.Validate(g.grid)
+		e.checked = true
+		if !e.validity.Perfect() && e.validity != was {
+			g.notify("Warning: " + describeValidity(e.validity))
+		}
+	}
+
+	return nil
+}
+
+// updateCarving toggles the wall under a click, or knocks down walls along a drag
+func (g *game) updateCarving() {
+	e := g.editor
+
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		if edge, ok := g.editTarget(); ok {
+			g.edit(editOp{kind: editWall, edge: edge})
+			g.commitEdit()
+		} else if t, _, _ := g.cursorTile(); t != nil {
+			e.carving = true
+			e.last = t
+		}
+	}
+
+	if !e.carving {
+		return
+	}
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		e.carving = false
+		g.commitEdit()
+		return
+	}
+
+	t, _, _ := g.cursorTile()
+	if t == nil {
+		return
+	}
+
+	// a fast drag can skip tiles, so walk there one step at a time
+	for a := e.last; a != t; {
+		b := g.stepTowards(a, t)
+		if utils.HasWall(a, b) {
+			g.edit(editOp{kind: editWall, edge: utils.Edge{A: a, B: b}})
+		}
+		a = b
+	}
+	e.last = t
+}
+
+// stepTowards is the neighbour of a whose centre is nearest to t's
+func (g *game) stepTowards(a, t *Tile) *Tile {
+	topo := g.grid.Topology()
+	tx, ty := topo.Centre(t)
+
+	var best *Tile
+	bestDist := math.Inf(1)
+	for side := range topo.Sides(a) {
+		row, col := topo.Neighbour(a, side)
+		if row < 0 || row >= len(g.grid) || col < 0 || col >= len(g.grid[row]) {
+			continue
+		}
+		x, y := topo.Centre(g.grid[row][col])
+		if dist := math.Hypot(x-tx, y-ty); dist < bestDist {
+			best, bestDist = g.grid[row][col], dist
+		}
+	}
+	return best
+}
+
+// moveMarker puts the start or goal on the tile under the cursor
+func (g *game) moveMarker(kind editKind) {
+	t, _, _ := g.cursorTile()
+	if t == nil {
+		return
+	}
+
+	to := mazesave.Position{Row: t.Row, Col: t.Col}
+	from, other := g.cfg.Start, g.cfg.Goal
+	if kind == editGoal {
+		from, other = other, from
+	}
+	if to == from {
+		return
+	}
+	if to == other {
+		g.notify("Start and goal must be on different tiles")
+		return
+	}
+
+	g.edit(editOp{kind: kind, from: from, to: to})
+	g.commitEdit()
+}
+
+// edit applies op and adds it to the action in progress
+func (g *game) edit(op editOp) {
+	g.applyEdit(op, true)
+	g.editor.action = append(g.editor.action, op)
+}
+
+// commitEdit closes off the action in progress as one undo entry
+func (g *game) commitEdit() {
+	e := g.editor
+	if len(e.action) == 0 {
+		return
+	}
+
+	e.undo = append(e.undo, e.action)
+	e.redo = nil
+	e.action = nil
+}
+
+func (g *game) undoEdit() {
+	e := g.editor
+	if len(e.undo) == 0 {
+		return
+	}
+
+	action := e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	for i := len(action) - 1; i >= 0; i-- {
+		g.applyEdit(action[i], false)
+	}
+	e.redo = append(e.redo, action)
+}
+
+func (g *game) redoEdit() {
+	e := g.editor
+	if len(e.redo) == 0 {
+		return
+	}
+
+	action := e.redo[len(e.redo)-1]
+	e.redo = e.redo[:len(e.redo)-1]
+	for _, op := range action {
+		g.applyEdit(op, true)
+	}
+	e.undo = append(e.undo, action)
+}
+
+// applyEdit makes op, or undoes it when forward is false. Any edit makes a different maze, so the
+// generation log and the leaderboard no longer apply.
+func (g *game) applyEdit(op editOp, forward bool) {
+	pos := op.to
+	if !forward {
+		pos = op.from
+	}
+
+	switch op.kind {
+	case editWall:
+		if utils.HasWall(op.edge.A, op.edge.B) {
+			utils.RemoveWalls(op.edge.A, op.edge.B)
+		} else {
+			utils.AddWalls(op.edge.A, op.edge.B)
+		}
+		g.canvas.markEdge(op.edge)
+	case editStart:
+		g.cfg.Start = pos
+	case editGoal:
+		g.cfg.Goal = pos
+	}
+
+	g.history = nil
+	g.board = nil
+	g.editor.checked = false
+}
+
+// cursorTile is the tile under the mouse and where the mouse is, in tile widths
+func (g *game) cursorTile() (*Tile, float64, float64) {
+	x, y := ebiten.CursorPosition()
+	wx, wy := g.cam.toWorld(float64(x), float64(y))
+	size := float64(g.cfg.TileSize)
+
+	tx, ty := wx/size, wy/size
+	return utils.TileAt(g.grid, tx, ty), tx, ty
+}
+
+// editTarget is the wall the cursor is near, if any. Walls on the border are left alone so the maze stays closed.
+func (g *game) editTarget() (utils.Edge, bool) {
+	t, x, y := g.cursorTile()
+	if t == nil {
+		return utils.Edge{}, false
+	}
+
+	topo := g.grid.Topology()
+	curved, _ := topo.(utils.Curved)
+	nearest, nearestDist := -1, math.Inf(1)
+	for side := range topo.Sides(t) {
+		x0, y0 := topo.Corner(t, side)
+		x1, y1 := topo.Corner(t, side+1)
+		// the cursor is inside t, so its distance to the side's line or circle is the distance to the side.
+		// Sides with no length come out as NaN and are never nearest.
+		dist := math.Abs((x1-x0)*(y-y0)-(y1-y0)*(x-x0)) / math.Hypot(x1-x0, y1-y0)
+		if curved != nil {
+			if cx, cy, radius, ok := curved.Arc(t, side); ok {
+				dist = math.Abs(math.Hypot(x-cx, y-cy) - radius)
+			}
+		}
+		if dist < nearestDist {
+			nearest, nearestDist = side, dist
+		}
+	}
+
+	row, col := topo.Neighbour(t, nearest)
+	if nearestDist > editGrab || row < 0 || row >= len(g.grid) || col < 0 || col >= len(g.grid[row]) {
+		return utils.Edge{}, false
+	}
+	return utils.Edge{A: t, B: g.grid[row][col]}, true
+}
+
+func describeValidity(v utils.Validity) string {
+	if v.Perfect() {
+		return "perfect maze"
+	}
+
+	var problems []string
+	if v.Regions > 1 {
+		problems = append(problems, fmt.Sprintf("%d disconnected regions", v.Regions))
+	}
+	if v.Loops > 0 {
+		problems = append(problems, fmt.Sprintf("%d loops", v.Loops))
+	}
+	return strings.Join(problems, ", ")
+}
+
+func (g *game) drawEditor(screen *ebiten.Image) {
+	th := g.cfg.Theme
+	inset := float64(g.cfg.WallThickness)
+	g.fillTile(screen, g.grid[g.cfg.Start.Row][g.cfg.Start.Col], inset, th.Start)
+	g.fillTile(screen, g.grid[g.cfg.Goal.Row][g.cfg.Goal.Col], inset, th.Goal)
+
+	edge, ok := g.editTarget()
+	if !ok || g.editor.carving {
+		return
+	}
+
+	// the wall runs along A's side facing B
+	size := float64(g.cfg.TileSize)
+	topo := g.grid.Topology()
+	points := utils.SidePoints(topo, edge.A, topo.Side(edge.A, edge.B), max(0.02, outlineStep/(size*g.cam.zoom)))
+
+	width := float32(max(2*g.scale, 2*inset*g.cam.zoom))
+	for i := range len(points) - 1 {
+		x0, y0 := g.cam.toScreen(points[i][0]*size, points[i][1]*size)
+		x1, y1 := g.cam.toScreen(points[i+1][0]*size, points[i+1][1]*size)
+		vector.StrokeLine(screen, x0, y0, x1, y1, width, th.Path, true)
+	}
+}
+
+func (g *game) drawEditorHUD(ui *ebiten.Image) {
+	e := g.editor
+	state := describeValidity(e.validity)
+	if !e.validity.Perfect() {
+		state = "Warning: " + state
+	}
+
+	drawHelp(ui, []string{
+		fmt.Sprintf("Editor  %d edits  %s", len(e.undo), state),
+		"Click a wall to toggle  drag to carve  1 start  2 goal under the cursor",
+		"Ctrl+Z undo  Ctrl+Y redo  S save  P play  E or Esc exit",
+		"Wheel or PgUp/PgDn zoom  right drag or Shift+arrows pan  C fit",
+	})
+}
@@ -1,11 +1,7 @@
 // Package dfs runs one iteration of the dfs maze generation algorithm. Add GetMazeState() func to cli to include in program
 package dfs
 
-import (
-	"math/rand"
-
-	"github.com/bailey4770/gomazing/utils"
-)
+import "github.com/bailey4770/gomazing/utils"
 
 type (
 	Tile = utils.Tile
@@ -13,21 +9,23 @@ type (
 )
 
 type mazeState struct {
-	stack   []*Tile
-	visited map[*Tile]struct{}
-	curr    *Tile
-	maxRows int
-	maxCols int
+	stack        []*Tile
+	visited      []bool
+	visitedCount int
+	// numTiles is how many tiles there are to visit, which is not rows times cols when rows differ in length
+	numTiles int
+	curr     *Tile
+	maxRows  int
+	maxCols  int
+	changes  []utils.Edge
 }
 
 func GetMazeState() *mazeState {
-	return &mazeState{
-		visited: make(map[*Tile]struct{}),
-	}
+	return &mazeState{}
 }
 
 func (m *mazeState) Initialise(grid Grid) error {
-	randomRow := rand.Intn(len(grid))
+	randomRow := utils.RandIntn(len(grid))
 	start, _, err := utils.GetRandomTile(grid[randomRow])
 	if err != nil {
 		return err
@@ -35,16 +33,23 @@ func (m *mazeState) Initialise(grid Grid) error {
 
 	m.curr = start
 	m.maxRows = len(grid)
-	m.maxCols = len(grid[0])
+	m.maxCols = grid.Cols()
+
+	m.numTiles = grid.Size()
+	m.visited = make([]bool, m.numTiles)
+	m.visited[grid.Index(start)] = true
+	m.visitedCount = 1
 
 	return nil
 }
 
 func (m *mazeState) Iterate(grid Grid) error {
+	m.changes = m.changes[:0]
+
 	neighbours := utils.FindNeighbours(m.curr, grid, m.maxRows, m.maxCols)
 	var unvisitedNeighbours []*Tile
 	for _, n := range neighbours {
-		if _, ok := m.visited[n]; !ok {
+		if !m.visited[grid.Index(n)] {
 			unvisitedNeighbours = append(unvisitedNeighbours, n)
 		}
 	}
@@ -57,8 +62,10 @@ func (m *mazeState) Iterate(grid Grid) error {
 
 		m.stack = append(m.stack, m.curr)
 		utils.RemoveWalls(m.curr, randUnvisited)
+		m.changes = append(m.changes, utils.Edge{A: m.curr, B: randUnvisited})
 
-		m.visited[randUnvisited] = struct{}{}
+		m.visited[grid.Index(randUnvisited)] = true
+		m.visitedCount++
 		m.curr = randUnvisited
 	} else if len(m.stack) > 0 {
 		m.curr = m.stack[len(m.stack)-1]
@@ -68,6 +75,15 @@ func (m *mazeState) Iterate(grid Grid) error {
 	return nil
 }
 
+// Changes lists the walls removed by the last Iterate
+func (m *mazeState) Changes() []utils.Edge {
+	return m.changes
+}
+
+func (m *mazeState) Inspect() utils.Inspection {
+	return utils.Inspection{Current: m.curr, Stack: m.stack}
+}
+
 func (m *mazeState) IsComplete() bool {
-	return len(m.visited) >= m.maxRows*m.maxCols
+	return m.visitedCount >= m.numTiles
 }
@@ -3,7 +3,6 @@ package kruskals
 
 import (
 	"errors"
-	"math/rand/v2"
 
 	"github.com/bailey4770/gomazing/utils"
 )
@@ -13,56 +12,65 @@ type (
 	Grid = utils.Grid
 )
 
-type wall struct {
-	tile1 *Tile
-	tile2 *Tile
-}
+// wall packs a tile index and which of its forward sides into one number (index*stride + k)
+// to keep huge grids small
+type wall uint32
 
 type mazeState struct {
 	tileSets       *utils.UnionFind
 	unionCount     int
 	unionsRequired int
 	walls          []wall
-	wallIdx        int
+	// stride is the most forward sides any tile has
+	stride  wall
+	wallIdx int
+	changes []utils.Edge
+	curr    *Tile
 }
 
 func GetMazeState() *mazeState {
 	return &mazeState{
-		tileSets:   utils.NewUnionFind(),
 		wallIdx:    0,
 		unionCount: 0,
 	}
 }
 
 func (m *mazeState) Initialise(grid Grid) error {
-	for i, row := range grid {
-		for j := range row {
-
-			tile := row[j]
-			// Add east wall if not on right edge
-			if j < len(row)-1 {
-				wallE := wall{tile1: tile, tile2: row[j+1]}
-				m.walls = append(m.walls, wallE)
-			}
-
-			// Add south wall if not on bottom edge
-			if i < len(grid)-1 {
-				wallS := wall{tile1: tile, tile2: grid[i+1][j]}
-				m.walls = append(m.walls, wallS)
+	m.tileSets = utils.NewUnionFind(grid)
+	topo := grid.Topology()
+	m.stride = 0
+	for _, row := range grid {
+		for _, tile := range row {
+			m.stride = max(m.stride, wall(len(topo.Forward(tile))))
+		}
+	}
+	m.walls = make([]wall, 0, int(m.stride)*grid.Size())
+
+	for _, row := range grid {
+		for _, tile := range row {
+			idx := wall(grid.Index(tile))
+			for k, side := range topo.Forward(tile) {
+				// skip walls on the edge of the grid
+				r, c := topo.Neighbour(tile, side)
+				if r >= 0 && r < len(grid) && c >= 0 && c < len(grid[r]) {
+					m.walls = append(m.walls, idx*m.stride+wall(k))
+				}
 			}
 		}
 	}
 
-	rand.Shuffle(len(m.walls), func(i, j int) {
+	utils.Shuffle(len(m.walls), func(i, j int) {
 		m.walls[i], m.walls[j] = m.walls[j], m.walls[i]
 	})
 
-	m.unionsRequired = len(grid)*len(grid[0]) - 1
+	m.unionsRequired = grid.Size() - 1
 
 	return nil
 }
 
 func (m *mazeState) Iterate(grid Grid) error {
+	m.changes = m.changes[:0]
+
 	if m.wallIdx >= len(m.walls) {
 		return errors.New("wall index out of wall slice range. Must be error in IsComplete func")
 	}
@@ -70,11 +78,15 @@ func (m *mazeState) Iterate(grid Grid) error {
 	currWall := m.walls[m.wallIdx]
 	m.wallIdx++
 
-	tile1 := currWall.tile1
-	tile2 := currWall.tile2
+	tile1 := grid.At(int(currWall / m.stride))
+	topo := tile1.Topology()
+	row, col := topo.Neighbour(tile1, topo.Forward(tile1)[currWall%m.stride])
+	tile2 := grid[row][col]
 
+	m.curr = tile1
 	if !m.tileSets.AreConnected(tile1, tile2) {
 		utils.RemoveWalls(tile1, tile2)
+		m.changes = append(m.changes, utils.Edge{A: tile1, B: tile2})
 		m.tileSets.Union(tile1, tile2)
 		m.unionCount++
 	}
@@ -82,6 +94,15 @@ func (m *mazeState) Iterate(grid Grid) error {
 	return nil
 }
 
+// Changes lists the walls removed by the last Iterate
+func (m *mazeState) Changes() []utils.Edge {
+	return m.changes
+}
+
+func (m *mazeState) Inspect() utils.Inspection {
+	return utils.Inspection{Current: m.curr, Sets: m.tileSets}
+}
+
 func (m *mazeState) IsComplete() bool {
 	return m.unionCount == m.unionsRequired
 }
@@ -3,7 +3,6 @@ package prims
 
 import (
 	"errors"
-	"math/rand"
 
 	"github.com/bailey4770/gomazing/utils"
 )
@@ -14,58 +13,62 @@ type (
 )
 
 type mazeState struct {
-	frontier map[*Tile]struct{}
-	visited  map[*Tile]struct{}
-	maxRows  int
-	maxCols  int
+	// frontier is a slice for O(1) random selection. frontierPos maps tile index to its slot, -1 when absent,
+	// so removal can swap with the last element instead of rebuilding the slice every iteration.
+	frontier    []*Tile
+	frontierPos []int32
+	visited     []bool
+	maxRows     int
+	maxCols     int
+	changes     []utils.Edge
+	curr        *Tile
 }
 
 func GetMazeState() *mazeState {
-	return &mazeState{
-		frontier: make(map[*Tile]struct{}),
-		visited:  make(map[*Tile]struct{}),
-	}
+	return &mazeState{}
 }
 
 func (m *mazeState) Initialise(grid Grid) error {
 	m.maxRows = len(grid)
-	m.maxCols = len(grid[0])
+	m.maxCols = grid.Cols()
+
+	m.visited = make([]bool, grid.Size())
+	m.frontierPos = make([]int32, grid.Size())
+	for i := range m.frontierPos {
+		m.frontierPos[i] = -1
+	}
 
-	randomRow := rand.Intn(len(grid))
+	randomRow := utils.RandIntn(len(grid))
 	start, _, err := utils.GetRandomTile(grid[randomRow])
 	if err != nil {
 		return err
 	}
-	m.visited[start] = struct{}{}
+	m.visited[grid.Index(start)] = true
 
 	neighbours := utils.FindNeighbours(start, grid, m.maxRows, m.maxCols)
 	for _, n := range neighbours {
-		m.frontier[n] = struct{}{}
+		m.addFrontier(grid, n)
 	}
 
 	return nil
 }
 
 func (m *mazeState) Iterate(grid Grid) error {
-	// getRandomTile takes a slice for efficient random selection.
-	// no good way of randomly selecting an element from a map in Go. Frontier remains a map for efficient contains checking and easy deletion from queue.
-	var frontierSlice []*Tile
-	for t := range m.frontier {
-		frontierSlice = append(frontierSlice, t)
-	}
-	frontierTile, _, err := utils.GetRandomTile(frontierSlice)
+	m.changes = m.changes[:0]
+
+	frontierTile, randomIndex, err := utils.GetRandomTile(m.frontier)
 	if err != nil {
 		return err
 	}
-	delete(m.frontier, frontierTile)
+	m.removeFrontier(grid, randomIndex)
 
 	neighbours := utils.FindNeighbours(frontierTile, grid, m.maxRows, m.maxCols)
 	var visitedNeighbours []*Tile
 	for _, n := range neighbours {
-		if _, ok := m.visited[n]; ok {
+		if m.visited[grid.Index(n)] {
 			visitedNeighbours = append(visitedNeighbours, n)
-		} else if _, ok := m.frontier[n]; !ok {
-			m.frontier[n] = struct{}{}
+		} else {
+			m.addFrontier(grid, n)
 		}
 	}
 
@@ -74,15 +77,47 @@ func (m *mazeState) Iterate(grid Grid) error {
 	}
 
 	// choose random tile from visited neighbours
-	randomIndex := rand.Intn(len(visitedNeighbours))
+	randomIndex = utils.RandIntn(len(visitedNeighbours))
 	visitedTile := visitedNeighbours[randomIndex]
 
 	utils.RemoveWalls(frontierTile, visitedTile)
-	m.visited[frontierTile] = struct{}{}
+	m.changes = append(m.changes, utils.Edge{A: frontierTile, B: visitedTile})
+	m.visited[grid.Index(frontierTile)] = true
+	m.curr = frontierTile
 
 	return nil
 }
 
+// Changes lists the walls removed by the last Iterate
+func (m *mazeState) Changes() []utils.Edge {
+	return m.changes
+}
+
+func (m *mazeState) Inspect() utils.Inspection {
+	return utils.Inspection{Current: m.curr, Frontier: m.frontier}
+}
+
 func (m *mazeState) IsComplete() bool {
 	return len(m.frontier) <= 0
 }
+
+func (m *mazeState) addFrontier(grid Grid, t *Tile) {
+	idx := grid.Index(t)
+	if m.frontierPos[idx] >= 0 {
+		return
+	}
+
+	m.frontierPos[idx] = int32(len(m.frontier))
+	m.frontier = append(m.frontier, t)
+}
+
+func (m *mazeState) removeFrontier(grid Grid, i int) {
+	last := len(m.frontier) - 1
+	m.frontierPos[grid.Index(m.frontier[i])] = -1
+
+	if i != last {
+		m.frontier[i] = m.frontier[last]
+		m.frontierPos[grid.Index(m.frontier[i])] = int32(i)
+	}
+	m.frontier = m.frontier[:last]
+}
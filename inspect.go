@@ -0,0 +1,79 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/bailey4770/gomazing/cli"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// drawInspection colours in the generator's working state. It is skipped once generation is done and
+// while rewound, when the generator's state no longer matches the walls on screen.
+func (g *game) drawInspection(screen *ebiten.Image) {
+	inspector, ok := g.generator.(cli.Inspector)
+	if !ok || g.hideInspection || g.generator.IsComplete() {
+		return
+	}
+	if g.history != nil && !g.history.AtHead() {
+		return
+	}
+
+	state := inspector.Inspect()
+	th := g.cfg.Theme
+	inset := float64(g.cfg.WallThickness)
+	fillTile := func(t *Tile, clr color.Color) {
+		g.fillTile(screen, t, inset, clr)
+	}
+
+	if state.Sets != nil {
+		rowStart, rowEnd, colStart, colEnd := g.visibleTiles()
+		for _, row := range g.grid[rowStart:rowEnd] {
+			for _, t := range row[colStart:min(colEnd, len(row))] {
+				if id, joined := state.Sets.SetID(t); joined {
+					fillTile(t, setColour(id))
+				}
+			}
+		}
+	}
+
+	for _, t := range state.Stack {
+		fillTile(t, th.Visited)
+	}
+	for _, t := range state.Frontier {
+		fillTile(t, th.Frontier)
+	}
+	if state.Current != nil {
+		fillTile(state.Current, th.Path)
+	}
+}
+
+// setColour spreads set ids around the colour wheel by the golden angle so neighbouring ids look different
+func setColour(id int) color.NRGBA {
+	hue := math.Mod(float64(id)*137.508, 360)
+	return hsvToNRGBA(hue, 0.55, 0.9, 150)
+}
+
+func hsvToNRGBA(hue, saturation, value float64, alpha uint8) color.NRGBA {
+	c := value * saturation
+	x := c * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := value - c
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = c, x, 0
+	case hue < 120:
+		r, g, b = x, c, 0
+	case hue < 180:
+		r, g, b = 0, c, x
+	case hue < 240:
+		r, g, b = 0, x, c
+	case hue < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.NRGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), alpha}
+}
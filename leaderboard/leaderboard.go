@@ -0,0 +1,150 @@
+// Package leaderboard keeps the best play mode runs for each maze in the save directory. Boards are keyed by
+// mazesave.PuzzleHash so a maze keeps its scores when renamed, copied or converted, but not when its start
+// or goal moves.
+package leaderboard
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+const (
+	// boardDir starts with a dot so it is never mistaken for a maze
+	boardDir = ".leaderboard"
+	// MaxRuns is how many runs each board keeps
+	MaxRuns = 10
+)
+
+// Step is the player arriving on a tile, At after the run began
+type Step struct {
+	At  time.Duration `json:"at"`
+	Row int           `json:"row"`
+	Col int           `json:"col"`
+}
+
+type Run struct {
+	Time  time.Duration `json:"time"`
+	Moves int           `json:"moves"`
+	Fog   bool          `json:"fog,omitempty"`
+	Date  time.Time     `json:"date"`
+	// Steps is the whole route so the run can be replayed as a ghost
+	Steps []Step `json:"steps"`
+}
+
+// Board holds the top runs for one maze, best first
+type Board struct {
+	Hash string `json:"hash"`
+	Runs []Run  `json:"runs"`
+
+	path string
+}
+
+// Load reads the board for the maze with hash from dir. A maze nobody has finished yet gets an empty board.
+func Load(dir, hash string) (*Board, error) {
+	if hash == "" {
+		return nil, errors.New("hash cannot be empty")
+	}
+
+	b := &Board{Hash: hash, path: filepath.Join(dir, boardDir, hash+".json")}
+
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read leaderboard: %v", err)
+	}
+
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("could not decode leaderboard: %v", err)
+	}
+	if b.Hash != hash {
+		return nil, fmt.Errorf("leaderboard %s is for maze %s", b.path, b.Hash)
+	}
+
+	return b, nil
+}
+
+// Add ranks run against the board and returns its 1 based place, or 0 if it did not make the top MaxRuns
+func (b *Board) Add(run Run) int {
+	place, _ := slices.BinarySearchFunc(b.Runs, run, compareRuns)
+	if place >= MaxRuns {
+		return 0
+	}
+
+	b.Runs = slices.Insert(b.Runs, place, run)
+	if len(b.Runs) > MaxRuns {
+		b.Runs = b.Runs[:MaxRuns]
+	}
+
+	return place + 1
+}
+
+// Prune drops runs with a step off grid, which only a hand edited or corrupt board can have, so their ghosts
+// never try to stand on a tile that is not there. It returns how many were dropped.
+func (b *Board) Prune(grid utils.Grid) int {
+	n := len(b.Runs)
+	b.Runs = slices.DeleteFunc(b.Runs, func(r Run) bool {
+		return slices.ContainsFunc(r.Steps, func(s Step) bool {
+			return s.Row < 0 || s.Row >= len(grid) || s.Col < 0 || s.Col >= len(grid[s.Row])
+		})
+	})
+
+	return n - len(b.Runs)
+}
+
+// Best is the top run, if there is one
+func (b *Board) Best() (Run, bool) {
+	if len(b.Runs) == 0 {
+		return Run{}, false
+	}
+	return b.Runs[0], true
+}
+
+func (b *Board) Save() error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode leaderboard: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o700); err != nil {
+		return fmt.Errorf("could not create leaderboard dir: %v", err)
+	}
+
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("could not write leaderboard: %v", err)
+	}
+
+	return os.Rename(tmp, b.path)
+}
+
+// Position is where a replay of r stands at elapsed. Steps must start with the start tile at zero.
+func (r Run) Position(elapsed time.Duration) (row, col int) {
+	if len(r.Steps) == 0 {
+		return 0, 0
+	}
+
+	i, found := slices.BinarySearchFunc(r.Steps, elapsed, func(s Step, at time.Duration) int {
+		return cmp.Compare(s.At, at)
+	})
+	if !found {
+		// the last step taken before elapsed
+		i = max(0, i-1)
+	}
+
+	return r.Steps[i].Row, r.Steps[i].Col
+}
+
+// faster wins, then fewer moves, then whoever got there first
+func compareRuns(a, b Run) int {
+	return cmp.Or(cmp.Compare(a.Time, b.Time), cmp.Compare(a.Moves, b.Moves), a.Date.Compare(b.Date))
+}
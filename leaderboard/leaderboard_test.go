@@ -0,0 +1,114 @@
+package leaderboard
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/gomazing/generators/dfs"
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/bailey4770/gomazing/utils/mazetest"
+)
+
+func TestLeaderboard(t *testing.T) {
+	grid := utils.NewGrid(6, 6)
+	mazetest.Generate(t, dfs.GetMazeState(), grid)
+
+	hash, err := mazesave.Hash(grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// metadata must not change the hash
+	meta := mazesave.NewMeta(grid, 10)
+	meta.Name = "renamed"
+	var buf bytes.Buffer
+	if err := mazesave.Encode(&buf, grid, meta); err != nil {
+		t.Fatal(err)
+	}
+	grid2, _, err := mazesave.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash2, _ := mazesave.Hash(grid2); hash2 != hash {
+		t.Fatalf("expected the same hash after saving but got %s and %s", hash, hash2)
+	}
+
+	// the default start and goal keep the plain hash, moving either gets a board of its own
+	if puzzle, _ := mazesave.PuzzleHash(grid, meta.Start, meta.Goal); puzzle != hash {
+		t.Fatalf("expected default endpoints to keep hash %s but got %s", hash, puzzle)
+	}
+	moved, _ := mazesave.PuzzleHash(grid, meta.Start, mazesave.Position{Row: 2, Col: 3})
+	swapped, _ := mazesave.PuzzleHash(grid, meta.Goal, meta.Start)
+	if moved == hash || swapped == hash || moved == swapped {
+		t.Fatal("expected moving the start or goal to change the hash")
+	}
+
+	dir := t.TempDir()
+	board, err := Load(dir, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := board.Best(); ok {
+		t.Fatal("expected a new board to be empty")
+	}
+
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range MaxRuns + 2 {
+		run := Run{Time: time.Duration(MaxRuns+2-i) * time.Second, Moves: 20, Date: date}
+		if place := board.Add(run); place != 1 {
+			t.Fatalf("run %d: expected each faster run to come first but got place %d", i, place)
+		}
+	}
+	if len(board.Runs) != MaxRuns {
+		t.Fatalf("expected board to keep %d runs but got %d", MaxRuns, len(board.Runs))
+	}
+	if place := board.Add(Run{Time: time.Hour, Date: date}); place != 0 {
+		t.Fatalf("expected a slow run to miss the board but got place %d", place)
+	}
+	if place := board.Add(Run{Time: time.Second, Moves: 10, Date: date}); place != 1 {
+		t.Fatalf("expected fewer moves to break a tie but got place %d", place)
+	}
+
+	if err := board.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(dir, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	best, _ := loaded.Best()
+	if len(loaded.Runs) != MaxRuns || best.Time != time.Second || best.Moves != 10 {
+		t.Fatalf("expected saved board back but got %+v", loaded.Runs)
+	}
+
+	ghost := Run{Steps: []Step{{0, 0, 0}, {time.Second, 0, 1}, {2 * time.Second, 1, 1}}}
+	for _, tc := range []struct {
+		at       time.Duration
+		row, col int
+	}{{0, 0, 0}, {500 * time.Millisecond, 0, 0}, {time.Second, 0, 1}, {time.Minute, 1, 1}} {
+		if row, col := ghost.Position(tc.at); row != tc.row || col != tc.col {
+			t.Fatalf("at %v expected ghost at (%d,%d) but got (%d,%d)", tc.at, tc.row, tc.col, row, col)
+		}
+	}
+}
+
+func TestPruneDropsRunsOffGrid(t *testing.T) {
+	grid := utils.NewGridOf(utils.Polar, 3, 0)
+	outer := grid.Cols() - 1
+	board := &Board{Runs: []Run{
+		{Time: time.Second, Steps: []Step{{0, 0, 0}, {time.Second, 2, outer}}},
+		// the inner ring is narrower than the outer one, so this col only exists further out
+		{Time: 2 * time.Second, Steps: []Step{{0, 0, 0}, {time.Second, 1, outer}}},
+		{Time: 3 * time.Second, Steps: []Step{{0, 3, 0}}},
+		{Time: 4 * time.Second, Steps: []Step{{0, -1, 0}}},
+	}}
+
+	if dropped := board.Prune(grid); dropped != 3 {
+		t.Fatalf("expected 3 runs dropped but got %d", dropped)
+	}
+	if len(board.Runs) != 1 || board.Runs[0].Time != time.Second {
+		t.Fatalf("expected only the run that stays on the grid but got %+v", board.Runs)
+	}
+}
@@ -0,0 +1,530 @@
+// Package library keeps an index of the mazes in the save directory, with metadata and thumbnails, and the file
+// operations on them. Call Open with cli.GetSaveDir() to get a Library.
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/gomazing/mazeexport"
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/bailey4770/gomazing/utils"
+)
+
+const (
+	// indexDir starts with a dot so it is never mistaken for a maze
+	indexDir      = ".library"
+	indexFile     = "index.json"
+	thumbsDir     = "thumbs"
+	thumbnailSize = 128
+)
+
+type Entry struct {
+	Name      string    `json:"name"`
+	Rows      int       `json:"rows"`
+	Cols      int       `json:"cols"`
+	Algorithm string    `json:"algorithm,omitempty"`
+	Created   time.Time `json:"created,omitzero"`
+	Tags      []string  `json:"tags,omitempty"`
+	// Thumbnail is a path relative to the save dir, empty if none could be rendered
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// ModTime and Size detect files changed outside the library so they can be re-indexed
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+}
+
+// Filter narrows List. Zero fields match everything.
+type Filter struct {
+	Algorithm string
+	Tag       string
+	MinRows   int
+	MaxRows   int
+	MinCols   int
+	MaxCols   int
+	Since     time.Time
+}
+
+type Library struct {
+	dir     string
+	entries map[string]*Entry
+}
+
+// Open loads the index for dir and brings it up to date with the files actually there
+func Open(dir string) (*Library, error) {
+	l := &Library{
+		dir:     dir,
+		entries: make(map[string]*Entry),
+	}
+
+	data, err := os.ReadFile(l.indexPath())
+	if err == nil {
+		var entries []*Entry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("could not parse library index: %v", err)
+		}
+		for _, e := range entries {
+			l.entries[e.Name] = e
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read library index: %v", err)
+	}
+
+	if err := l.sync(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+func (l *Library) Path(name string) string {
+	return filepath.Join(l.dir, name)
+}
+
+func (l *Library) Get(name string) (Entry, bool) {
+	e, ok := l.entries[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// List returns matching entries, newest first
+func (l *Library) List(f Filter) []Entry {
+	var entries []Entry
+	for _, e := range l.entries {
+		if f.matches(e) {
+			entries = append(entries, *e)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if c := b.Created.Compare(a.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return entries
+}
+
+// Search matches query case insensitively against names, algorithms and tags
+func (l *Library) Search(query string) []Entry {
+	query = strings.ToLower(query)
+
+	var entries []Entry
+	for _, e := range l.List(Filter{}) {
+		haystack := append([]string{e.Name, e.Algorithm}, e.Tags...)
+		if slices.ContainsFunc(haystack, func(s string) bool {
+			return strings.Contains(strings.ToLower(s), query)
+		}) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+func (l *Library) Rename(oldName, newName string) error {
+	e, err := l.mustGet(oldName)
+	if err != nil {
+		return err
+	}
+	if err := l.checkFree(newName); err != nil {
+		return err
+	}
+
+	if err := os.Rename(l.Path(oldName), l.Path(newName)); err != nil {
+		return fmt.Errorf("could not rename %s: %v", oldName, err)
+	}
+
+	delete(l.entries, oldName)
+	e.Name = newName
+	l.entries[newName] = e
+
+	if e.Thumbnail != "" {
+		newThumb := thumbnailPath(newName)
+		if err := os.Rename(filepath.Join(l.dir, e.Thumbnail), filepath.Join(l.dir, newThumb)); err != nil {
+			e.Thumbnail = ""
+		} else {
+			e.Thumbnail = newThumb
+		}
+	}
+
+	return l.save()
+}
+
+func (l *Library) Delete(name string) error {
+	e, err := l.mustGet(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(l.Path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not delete %s: %v", name, err)
+	}
+	l.forget(e)
+	return l.save()
+}
+
+// forget drops e and its thumbnail from the index without saving it
+func (l *Library) forget(e *Entry) {
+	if e.Thumbnail != "" {
+		_ = os.Remove(filepath.Join(l.dir, e.Thumbnail))
+	}
+	delete(l.entries, e.Name)
+}
+
+func (l *Library) Duplicate(name, newName string) error {
+	e, err := l.mustGet(name)
+	if err != nil {
+		return err
+	}
+	if err := l.checkFree(newName); err != nil {
+		return err
+	}
+
+	if err := copyFile(l.Path(name), l.Path(newName)); err != nil {
+		return err
+	}
+
+	duplicate := *e
+	duplicate.Name = newName
+	duplicate.Tags = slices.Clone(e.Tags)
+	return l.index(&duplicate)
+}
+
+// Import copies a maze from anywhere on disk into the library, checking it loads first
+func (l *Library) Import(srcPath, name string) error {
+	if name == "" {
+		name = filepath.Base(srcPath)
+	}
+	if err := l.checkFree(name); err != nil {
+		return err
+	}
+
+	if _, _, err := mazesave.LoadMaze(srcPath); err != nil {
+		return fmt.Errorf("%s is not a valid maze: %v", srcPath, err)
+	}
+
+	if err := copyFile(srcPath, l.Path(name)); err != nil {
+		return err
+	}
+
+	return l.index(&Entry{Name: name})
+}
+
+// Export copies a maze out of the library. dstPath may be a directory.
+func (l *Library) Export(name, dstPath string) error {
+	if _, err := l.mustGet(name); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(dstPath); err == nil && info.IsDir() {
+		dstPath = filepath.Join(dstPath, name)
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("%s already exists", dstPath)
+	}
+
+	return copyFile(l.Path(name), dstPath)
+}
+
+func (l *Library) AddTags(name string, tags ...string) error {
+	e, err := l.mustGet(name)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if tag != "" && !slices.Contains(e.Tags, tag) {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	slices.Sort(e.Tags)
+
+	return l.save()
+}
+
+func (l *Library) RemoveTags(name string, tags ...string) error {
+	e, err := l.mustGet(name)
+	if err != nil {
+		return err
+	}
+
+	e.Tags = slices.DeleteFunc(e.Tags, func(tag string) bool {
+		return slices.Contains(tags, tag)
+	})
+
+	return l.save()
+}
+
+// ValidateName rejects names that would escape the save dir or collide with the index
+func ValidateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name cannot be empty")
+	case strings.HasPrefix(name, "."):
+		return errors.New("name cannot start with '.'")
+	case strings.ContainsAny(name, `/\`):
+		return errors.New("name cannot contain path separators")
+	case name != filepath.Base(name):
+		return fmt.Errorf("%q is not a plain file name", name)
+	}
+
+	return nil
+}
+
+// sync indexes new or changed files and forgets ones that have gone
+func (l *Library) sync() error {
+	files, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("could not read dir %s: %v", l.dir, err)
+	}
+
+	changed := false
+	seen := make(map[string]bool)
+
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		seen[file.Name()] = true
+
+		e, ok := l.entries[file.Name()]
+		if ok && e.ModTime.Equal(info.ModTime()) && e.Size == info.Size() {
+			continue
+		}
+
+		// keep user tags across re-indexing
+		entry := &Entry{Name: file.Name()}
+		if ok {
+			entry.Tags = e.Tags
+		}
+		if err := l.fill(entry); err != nil {
+			// not every file in the dir has to be a maze, but one that was stops being listed once it cannot be read
+			if ok {
+				l.forget(e)
+				changed = true
+			}
+			continue
+		}
+		l.entries[entry.Name] = entry
+		changed = true
+	}
+
+	for name, e := range l.entries {
+		if !seen[name] {
+			l.forget(e)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return l.save()
+}
+
+// index fills in an entry from its file and saves the index
+func (l *Library) index(e *Entry) error {
+	if err := l.fill(e); err != nil {
+		return err
+	}
+
+	l.entries[e.Name] = e
+	return l.save()
+}
+
+// fill reads the maze file behind e and renders its thumbnail
+func (l *Library) fill(e *Entry) error {
+	path := l.Path(e.Name)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("could not stat %s: %v", e.Name, err)
+	}
+
+	grid, meta, err := mazesave.LoadMaze(path)
+	if err != nil {
+		return err
+	}
+
+	e.Rows, e.Cols = len(grid), grid.Cols()
+	e.Algorithm = meta.Algorithm
+	e.Created = meta.Created
+	// tags saved in the file join any added through the library
+	for _, tag := range meta.Tags {
+		if !slices.Contains(e.Tags, tag) {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	slices.Sort(e.Tags)
+	e.ModTime = info.ModTime()
+	e.Size = info.Size()
+
+	if err := l.writeThumbnail(e.Name, grid); err != nil {
+		e.Thumbnail = ""
+	} else {
+		e.Thumbnail = thumbnailPath(e.Name)
+	}
+
+	return nil
+}
+
+// writeThumbnail renders up to thumbnailSize pixels square. Mazes too big to fit even at two pixels
+// per tile are cropped to their top left corner, or for polar mazes to the rings round the centre.
+func (l *Library) writeThumbnail(name string, grid utils.Grid) error {
+	var crop utils.Grid
+	var cellSize int
+	if grid.Topology().Shape() == utils.ShapePolar {
+		// polar mazes are two tiles across per ring
+		cellSize = max(2, min(8, thumbnailSize/(2*len(grid))))
+		crop = grid[:min(len(grid), thumbnailSize/(2*cellSize))]
+	} else {
+		cellSize = max(2, min(8, thumbnailSize/max(len(grid), len(grid[0]))))
+
+		numRows := min(len(grid), thumbnailSize/cellSize)
+		numCols := min(len(grid[0]), thumbnailSize/cellSize)
+		crop = make(utils.Grid, numRows)
+		for i := range crop {
+			crop[i] = grid[i][:numCols]
+		}
+	}
+
+	img := mazeexport.RenderPaletted(crop, cellSize, 1, color.Palette{color.Black, color.White})
+
+	path := filepath.Join(l.dir, thumbnailPath(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// save writes the index to a temp file first so a crash never leaves it half written
+func (l *Library) save() error {
+	entries := make([]*Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b *Entry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode library index: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(l.dir, indexDir), 0o700); err != nil {
+		return fmt.Errorf("could not create library dir: %v", err)
+	}
+
+	tmp := l.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("could not write library index: %v", err)
+	}
+
+	return os.Rename(tmp, l.indexPath())
+}
+
+func (l *Library) indexPath() string {
+	return filepath.Join(l.dir, indexDir, indexFile)
+}
+
+func (l *Library) mustGet(name string) (*Entry, error) {
+	e, ok := l.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("no maze called %s", name)
+	}
+	return e, nil
+}
+
+func (l *Library) checkFree(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(l.Path(name)); err == nil {
+		return fmt.Errorf("a maze called %s already exists", name)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not check for %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func (f Filter) matches(e *Entry) bool {
+	switch {
+	case f.Algorithm != "" && !strings.EqualFold(f.Algorithm, e.Algorithm):
+		return false
+	case f.Tag != "" && !slices.Contains(e.Tags, f.Tag):
+		return false
+	case f.MinRows > 0 && e.Rows < f.MinRows:
+		return false
+	case f.MaxRows > 0 && e.Rows > f.MaxRows:
+		return false
+	case f.MinCols > 0 && e.Cols < f.MinCols:
+		return false
+	case f.MaxCols > 0 && e.Cols > f.MaxCols:
+		return false
+	case !f.Since.IsZero() && e.Created.Before(f.Since):
+		return false
+	}
+
+	return true
+}
+
+func thumbnailPath(name string) string {
+	return filepath.Join(indexDir, thumbsDir, name+".png")
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", src, err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", dst, err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("could not copy %s to %s: %v", src, dst, err)
+	}
+
+	return out.Close()
+}
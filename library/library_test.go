@@ -0,0 +1,116 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bailey4770/gomazing/generators/dfs"
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/bailey4770/gomazing/utils/mazetest"
+)
+
+func saveTestMaze(t *testing.T, dir, name, algorithm string, numRows, numCols int) {
+	t.Helper()
+
+	grid := utils.NewGrid(numRows, numCols)
+	mazetest.Generate(t, dfs.GetMazeState(), grid)
+
+	meta := mazesave.NewMeta(grid, 10)
+	meta.Algorithm = algorithm
+	if err := mazesave.SaveMaze(grid, meta, filepath.Join(dir, name)); err != nil {
+		t.Fatalf("could not save maze: %v", err)
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	dir := t.TempDir()
+	saveTestMaze(t, dir, "small", "dfs", 5, 5)
+	saveTestMaze(t, dir, "wide", "prims", 5, 40)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a maze"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatalf("could not open library: %v", err)
+	}
+
+	if got := len(lib.List(Filter{})); got != 2 {
+		t.Fatalf("expected 2 mazes but got %d", got)
+	}
+	if got := lib.List(Filter{MinCols: 10}); len(got) != 1 || got[0].Name != "wide" {
+		t.Fatalf("expected only wide to have at least 10 cols but got %v", got)
+	}
+
+	e, _ := lib.Get("small")
+	if _, err := os.Stat(filepath.Join(dir, e.Thumbnail)); err != nil {
+		t.Fatalf("expected thumbnail to exist: %v", err)
+	}
+
+	if err := lib.AddTags("small", "easy", "kids"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Rename("small", "tiny"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Duplicate("tiny", "tiny copy"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lib.List(Filter{Tag: "kids"}); len(got) != 2 {
+		t.Fatalf("expected tags to follow rename and duplicate but got %v", got)
+	}
+
+	if err := lib.Rename("tiny", "../escape"); err == nil {
+		t.Fatal("expected error renaming outside the save dir")
+	}
+	if err := lib.Duplicate("tiny", "wide"); err == nil {
+		t.Fatal("expected error duplicating over an existing maze")
+	}
+
+	exportDir := t.TempDir()
+	if err := lib.Export("wide", exportDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Delete("wide"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Import(filepath.Join(exportDir, "wide"), "imported"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Import(filepath.Join(dir, "notes.txt"), "notes"); err == nil {
+		t.Fatal("expected error importing a file that is not a maze")
+	}
+
+	// reopening reads the saved index and must agree with what we did
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Search("PRIMS"); len(got) != 1 || got[0].Name != "imported" {
+		t.Fatalf("expected search to find imported prims maze but got %v", got)
+	}
+	if got := reopened.Search("kid"); len(got) != 2 {
+		t.Fatalf("expected search to match tags but got %v", got)
+	}
+
+	// a maze that stops parsing is dropped along with its thumbnail rather than listed until it is loaded
+	copied, _ := reopened.Get("tiny copy")
+	if copied.Thumbnail == "" {
+		t.Fatal("expected duplicate to have a thumbnail")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tiny copy"), []byte("corrupted"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get("tiny copy"); ok {
+		t.Fatal("expected unreadable maze to be dropped from the index")
+	}
+	if _, err := os.Stat(filepath.Join(dir, copied.Thumbnail)); !os.IsNotExist(err) {
+		t.Fatalf("expected thumbnail of unreadable maze to be removed but got %v", err)
+	}
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
 
 	"github.com/bailey4770/gomazing/cli"
-	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/bailey4770/gomazing/leaderboard"
+	"github.com/bailey4770/gomazing/mazeexport"
 	"github.com/bailey4770/gomazing/utils"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
@@ -23,108 +21,229 @@ type (
 )
 
 type game struct {
-	cfg        Config
-	grid       Grid
-	generator  Generator
-	complete   bool
-	isTyping   bool
-	nameBuffer []rune
+	cfg       Config
+	grid      Grid
+	generator Generator
+	complete  bool
+	recorder  *mazeexport.Recorder
+	browser   *browser
+	dialog    *saveDialog
+	play      *playState
+	editor    *editor
+	controls  playback
+	history   *utils.History
+	canvas    *mazeCanvas
+	cam       camera
+	scrubbing bool
+	// hideInspection turns off drawing the generator's frontier, stack and sets
+	hideInspection bool
+	// board is the leaderboard for grid, loaded when play first needs it
+	board *leaderboard.Board
+	// status is a short message shown on screen until statusTicks runs out
+	status      string
+	statusTicks int
+	// screenW and screenH are the screen in physical pixels, uiW and uiH in logical ones.
+	// scale is the monitor's device scale factor between the two.
+	screenW, screenH int
+	uiW, uiH         int
+	scale            float64
+	ui               *ebiten.Image
 }
 
 func initGrid(cfg Config) Grid {
-	// allocate row slices
-	grid := make(Grid, cfg.MaxRows)
+	return utils.NewGridOf(cfg.Topology, cfg.MaxRows, cfg.MaxCols)
+}
 
-	for row := range grid {
-		grid[row] = make([]*Tile, cfg.MaxCols)
-		posY := float64(row * cfg.TileSize)
+func (g *game) Update() error {
+	if g.statusTicks > 0 {
+		g.statusTicks--
+	}
 
-		for col := range grid[row] {
-			posX := float64(col * cfg.TileSize)
-			grid[row][col] = utils.CreateTile(posX, posY, row, col)
-		}
+	if g.browser != nil {
+		return g.updateBrowser()
 	}
 
-	return grid
-}
+	g.updateCamera()
 
-func (g *game) Update() error {
-	if g.generator == nil {
-		return nil
+	if g.play != nil {
+		return g.updatePlay()
 	}
 
-	// Must come before "press S" check otherwise s added to input buffer
-	if g.isTyping {
-		g.nameBuffer = ebiten.AppendInputChars(g.nameBuffer)
+	if g.editor != nil && g.dialog == nil {
+		return g.updateEditor()
+	}
 
-		if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(g.nameBuffer) > 0 {
-			g.nameBuffer = g.nameBuffer[:len(g.nameBuffer)-1]
+	// Must come before any other key checks otherwise typed letters trigger them
+	if g.dialog != nil {
+		if err := g.updateSaveDialog(); err != nil {
+			return err
 		}
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+		if err := g.openBrowser(); err != nil {
+			g.notify(fmt.Sprintf("Could not open load browser: %v", err))
+		}
+		return nil
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		// complete is only set once the svg and recording are written
+		if g.generator != nil && !g.complete {
+			g.notify("Wait until the maze has finished generating")
+		} else {
+			g.seekToHead()
+			g.startPlay(g.cfg.Fog)
+		}
+		return nil
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+		if g.generator != nil && !g.complete {
+			g.notify("Wait until the maze has finished generating")
+		} else {
+			g.startEditor()
+		}
+		return nil
+	} else if restarted, err := g.updateControls(); restarted || err != nil {
+		return err
+	}
 
-		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
-			log.Print("Saving maze...")
-
-			saveDir, err := cli.GetSaveDir()
-			if err != nil {
-				return fmt.Errorf("could not get save dir: %v", err)
-			}
+	if g.generator == nil {
+		return nil
+	}
 
-			fileName := string(g.nameBuffer)
-			filePath := filepath.Join(saveDir, fileName)
+	for range g.controls.steps() {
+		// replay from the log until caught up with the generator
+		if g.history != nil && !g.history.AtHead() {
+			g.seek(g.history.Cursor() + 1)
+			continue
+		}
 
-			if _, err := os.Stat(filePath); err == nil {
-				log.Printf("file with name %s already exists", fileName)
-				return nil
-			} else if !errors.Is(err, fs.ErrNotExist) {
-				return fmt.Errorf("file does not exist, but there was some other error: %v", err)
-			}
+		if g.generator.IsComplete() {
+			break
+		}
 
-			if err = mazesave.SaveMaze(g.grid, g.cfg.TileSize, filePath); err != nil {
-				return fmt.Errorf("could not save maze: %v", err)
-			}
+		if err := g.generator.Iterate(g.grid); err != nil {
+			return err
+		}
+		g.controls.iterations++
+		g.recordChanges()
+		g.markChanges()
 
-			log.Print("Maze successfully saved")
-			g.isTyping = false
+		if g.recorder != nil {
+			g.recorder.Step(g.grid)
 		}
 	}
 
-	for range g.cfg.Speed {
-		if !g.generator.IsComplete() {
-			err := g.generator.Iterate(g.grid)
-			if err != nil {
-				return err
-			}
-		} else if !g.complete {
-			log.Print("maze complete")
-			g.complete = true
+	if g.generator.IsComplete() && !g.complete {
+		log.Print("maze complete")
+		g.complete = true
+
+		if err := g.exportSVG(); err != nil {
+			return err
+		}
+		if err := g.saveRecording(); err != nil {
+			return err
 		}
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+	if g.dialog == nil && inpututil.IsKeyJustPressed(ebiten.KeyS) {
 		if !g.generator.IsComplete() {
-			log.Print("Error: wait until the maze has finished generating.")
+			g.notify("Wait until the maze has finished generating")
 		} else {
-			g.isTyping = true
+			g.seekToHead()
+			g.openSaveDialog()
 		}
 	}
 
 	return nil
 }
 
+// setGrid swaps in a new maze and starts a fresh cache for it
+func (g *game) setGrid(grid Grid) {
+	g.canvas.dispose()
+	g.grid = grid
+	g.canvas = newMazeCanvas(grid, g.cfg)
+}
+
+// markChanges queues the tiles the last Iterate touched for redrawing. Generators that cannot say
+// what they changed get the whole maze redrawn.
+func (g *game) markChanges() {
+	reporter, ok := g.generator.(cli.ChangeReporter)
+	if !ok {
+		g.canvas.invalidate()
+		return
+	}
+
+	for _, e := range reporter.Changes() {
+		g.canvas.markEdge(e)
+	}
+}
+
+func (g *game) exportSVG() error {
+	if g.cfg.SVGPath == "" {
+		return nil
+	}
+
+	opts := mazeexport.DefaultSVGOptions()
+	if g.cfg.ThemeExports {
+		opts = mazeexport.ThemedSVGOptions(g.cfg.Theme)
+	}
+	opts.CellSize = float64(g.cfg.TileSize)
+	opts.Page = g.cfg.SVGPage
+	if g.cfg.SVGSolution {
+		start, goal := g.cfg.Start, g.cfg.Goal
+		opts.Solution = utils.Solve(g.grid, g.grid[start.Row][start.Col], g.grid[goal.Row][goal.Col])
+	}
+
+	if err := mazeexport.SaveSVG(g.grid, opts, g.cfg.SVGPath); err != nil {
+		return fmt.Errorf("could not export svg: %v", err)
+	}
+
+	log.Printf("Maze exported to %s", g.cfg.SVGPath)
+	return nil
+}
+
+func (g *game) saveRecording() error {
+	if g.recorder == nil {
+		return nil
+	}
+
+	// always finish on the completed maze, whatever the stride
+	g.recorder.Capture(g.grid)
+
+	if err := g.recorder.Save(g.cfg.RecordPath); err != nil {
+		return fmt.Errorf("could not save recording: %v", err)
+	}
+
+	log.Printf("Recorded %d frames to %s", g.recorder.FrameCount(), g.cfg.RecordPath)
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lib" {
+		if err := cli.RunLibrary(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal("Error: ", err)
+		}
+		return
+	}
+
 	// Set up ebiten game
 	cfg, err := cli.GetConfig()
 	if err != nil {
 		log.Fatalf("Error getting config: %v", err)
 	}
 
-	grid := initGrid(cfg)
+	utils.Seed(cfg.Seed)
+
+	grid := cfg.Grid
+	if grid == nil {
+		grid = initGrid(cfg)
+	}
+
 	game := &game{
 		cfg:       cfg,
 		grid:      grid,
 		generator: cfg.Generator,
 		complete:  false,
-		isTyping:  false,
+		controls:  newPlayback(cfg.Speed),
+		canvas:    newMazeCanvas(grid, cfg),
+		scale:     1,
 	}
 
 	if game.generator != nil {
@@ -132,14 +251,27 @@ func main() {
 		if err := game.generator.Initialise(grid); err != nil {
 			log.Fatalf("Error: %v", err)
 		}
+		game.history = utils.NewHistory()
+
+		if cfg.RecordPath != "" {
+			game.recorder, err = mazeexport.NewRecorder(cfg.RecordOpts)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			game.recorder.Capture(grid)
+		}
 	} else {
-		err := mazesave.LoadMazeWalls(game.cfg.MazePath, game.grid)
-		if err != nil {
+		if cfg.RecordPath != "" {
+			log.Print("Ignoring -record: loaded mazes have no generation to record")
+		}
+
+		if err := game.exportSVG(); err != nil {
 			log.Fatal("Error:", err)
 		}
 	}
 
 	ebiten.SetWindowSize(cfg.WindowWidth, cfg.WindowHeight)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 	ebiten.SetWindowTitle("Gomazing")
 	// Start game loop
 	if err := ebiten.RunGame(game); err != nil {
@@ -0,0 +1,242 @@
+package mazeexport
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math"
+	"os"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+// palette indices used by RenderPaletted
+const (
+	backgroundIndex = 0
+	wallIndex       = 1
+)
+
+func GetPalettes() map[string]color.Palette {
+	return map[string]color.Palette{
+		"mono":  {color.Black, color.White},
+		"paper": {color.White, color.Black},
+		"green": {color.RGBA{10, 20, 10, 255}, color.RGBA{80, 220, 100, 255}},
+	}
+}
+
+type GIFOptions struct {
+	// Stride is how many Step calls happen between captured frames
+	Stride int
+	// Delay between frames in hundredths of a second
+	Delay int
+	// FinalDelay holds the last frame so the finished maze is visible before looping
+	FinalDelay    int
+	CellSize      int
+	WallThickness int
+	// Palette needs at least two colours: background then walls
+	Palette color.Palette
+}
+
+func DefaultGIFOptions() GIFOptions {
+	return GIFOptions{
+		Stride:        10,
+		Delay:         2,
+		FinalDelay:    200,
+		CellSize:      10,
+		WallThickness: 1,
+		Palette:       GetPalettes()["mono"],
+	}
+}
+
+// Recorder renders the grid headlessly every Stride steps and collects the frames into an animated GIF.
+// Frames after the first only store the rectangle that changed, which keeps files small.
+type Recorder struct {
+	opts  GIFOptions
+	anim  gif.GIF
+	prev  *image.Paletted
+	steps int
+}
+
+func NewRecorder(opts GIFOptions) (*Recorder, error) {
+	if opts.Stride <= 0 {
+		return nil, errors.New("frame stride must be positive")
+	}
+	if opts.CellSize <= 0 {
+		return nil, errors.New("cell size must be positive")
+	}
+	if len(opts.Palette) < 2 {
+		return nil, errors.New("palette needs a background and a wall colour")
+	}
+
+	return &Recorder{opts: opts}, nil
+}
+
+// Step counts one iteration of a generator or solver and captures a frame every Stride steps
+func (r *Recorder) Step(grid utils.Grid) {
+	r.steps++
+	if r.steps%r.opts.Stride == 0 {
+		r.Capture(grid)
+	}
+}
+
+// Capture adds a frame of the current grid state regardless of stride
+func (r *Recorder) Capture(grid utils.Grid) {
+	frame := RenderPaletted(grid, r.opts.CellSize, r.opts.WallThickness, r.opts.Palette)
+
+	if r.prev == nil {
+		r.anim.Image = append(r.anim.Image, frame)
+		r.anim.Delay = append(r.anim.Delay, r.opts.Delay)
+		r.anim.Disposal = append(r.anim.Disposal, gif.DisposalNone)
+		r.anim.Config = image.Config{
+			ColorModel: frame.Palette,
+			Width:      frame.Rect.Dx(),
+			Height:     frame.Rect.Dy(),
+		}
+		r.prev = frame
+		return
+	}
+
+	changed := diffBounds(r.prev, frame)
+	r.prev = frame
+	if changed.Empty() {
+		// nothing moved, so lengthen the previous frame instead of adding a duplicate
+		r.anim.Delay[len(r.anim.Delay)-1] += r.opts.Delay
+		return
+	}
+
+	r.anim.Image = append(r.anim.Image, cropPaletted(frame, changed))
+	r.anim.Delay = append(r.anim.Delay, r.opts.Delay)
+	r.anim.Disposal = append(r.anim.Disposal, gif.DisposalNone)
+}
+
+func (r *Recorder) FrameCount() int {
+	return len(r.anim.Image)
+}
+
+func (r *Recorder) Encode(w io.Writer) error {
+	if len(r.anim.Image) == 0 {
+		return errors.New("no frames recorded")
+	}
+
+	r.anim.Delay[len(r.anim.Delay)-1] = max(r.anim.Delay[len(r.anim.Delay)-1], r.opts.FinalDelay)
+
+	return gif.EncodeAll(w, &r.anim)
+}
+
+func (r *Recorder) Save(fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %v", fileName, err)
+	}
+
+	if err := r.Encode(file); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not encode gif: %v", err)
+	}
+
+	return file.Close()
+}
+
+// RenderPaletted draws the grid walls into a paletted image using the same geometry as the game renderer
+func RenderPaletted(grid utils.Grid, cellSize, wallThickness int, palette color.Palette) *image.Paletted {
+	numRows, numCols := len(grid), grid.Cols()
+
+	topo := grid.Topology()
+	gridW, gridH := topo.Size(numRows, numCols)
+	width := int(math.Ceil(gridW * float64(cellSize)))
+	height := int(math.Ceil(gridH * float64(cellSize)))
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	// NewPaletted zero fills, which is already the background index
+
+	fill := func(x0, y0, x1, y1 int) {
+		x0, y0 = max(0, x0), max(0, y0)
+		x1, y1 = min(width, x1), min(height, y1)
+		for y := y0; y < y1; y++ {
+			row := img.Pix[y*img.Stride : (y+1)*img.Stride]
+			for x := x0; x < x1; x++ {
+				row[x] = wallIndex
+			}
+		}
+	}
+
+	if topo != utils.Square {
+		drawSegments(grid, float64(cellSize), wallThickness, fill)
+		return img
+	}
+
+	for _, row := range grid {
+		for _, t := range row {
+			x, y := t.Col*cellSize, t.Row*cellSize
+
+			if t.Wall(utils.North) {
+				fill(x, y, x+cellSize, y+wallThickness)
+			}
+			if t.Wall(utils.South) {
+				fill(x, y+cellSize-wallThickness, x+cellSize, y+cellSize)
+			}
+			if t.Wall(utils.West) {
+				fill(x, y, x+wallThickness, y+cellSize)
+			}
+			if t.Wall(utils.East) {
+				fill(x+cellSize-wallThickness, y, x+cellSize, y+cellSize)
+			}
+		}
+	}
+
+	return img
+}
+
+// drawSegments stamps a thickness wide square every pixel along each wall, for walls that are not
+// lined up with the pixel grid. Curved walls are drawn as short straight pieces.
+func drawSegments(grid utils.Grid, scale float64, thickness int, fill func(x0, y0, x1, y1 int)) {
+	for _, s := range wallSegments(grid) {
+		points := s.points(4 / scale)
+		for i := range len(points) - 1 {
+			x1, y1 := points[i][0]*scale, points[i][1]*scale
+			x2, y2 := points[i+1][0]*scale, points[i+1][1]*scale
+			steps := int(math.Ceil(math.Hypot(x2-x1, y2-y1)))
+
+			for j := 0; j <= steps; j++ {
+				f := float64(j) / float64(max(1, steps))
+				x := int(math.Round(x1+(x2-x1)*f)) - thickness/2
+				y := int(math.Round(y1+(y2-y1)*f)) - thickness/2
+				fill(x, y, x+thickness, y+thickness)
+			}
+		}
+	}
+}
+
+// diffBounds returns the smallest rectangle containing every pixel that differs between two same sized frames
+func diffBounds(a, b *image.Paletted) image.Rectangle {
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	minX, minY, maxX, maxY := w, h, -1, -1
+
+	for y := range h {
+		rowA := a.Pix[y*a.Stride : y*a.Stride+w]
+		rowB := b.Pix[y*b.Stride : y*b.Stride+w]
+		for x := range w {
+			if rowA[x] != rowB[x] {
+				minX, maxX = min(minX, x), max(maxX, x)
+				minY, maxY = min(minY, y), max(maxY, y)
+			}
+		}
+	}
+
+	if maxX < 0 {
+		return image.Rectangle{}
+	}
+
+	return image.Rect(minX, minY, maxX+1, maxY+1)
+}
+
+// cropPaletted copies a region into its own image. SubImage would keep the whole backing array alive.
+func cropPaletted(img *image.Paletted, rect image.Rectangle) *image.Paletted {
+	cropped := image.NewPaletted(rect, img.Palette)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		copy(cropped.Pix[(y-rect.Min.Y)*cropped.Stride:], img.Pix[y*img.Stride+rect.Min.X:y*img.Stride+rect.Max.X])
+	}
+	return cropped
+}
@@ -0,0 +1,116 @@
+package mazeexport
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"testing"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+func TestRecorderFrames(t *testing.T) {
+	opts := DefaultGIFOptions()
+	opts.Stride = 2
+	opts.CellSize = 4
+	rec, err := NewRecorder(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// knock a wall through every step so each captured frame differs from the last
+	grid := utils.NewGrid(1, 6)
+	for c := range 5 {
+		utils.RemoveWalls(grid[0][c], grid[0][c+1])
+		rec.Step(grid)
+	}
+	// steps 2 and 4 were captured
+	if rec.FrameCount() != 2 {
+		t.Fatalf("expected 2 frames but got %d", rec.FrameCount())
+	}
+
+	// the wall from step 5 makes one more frame, then nothing changes so that frame is held for longer
+	rec.Capture(grid)
+	rec.Capture(grid)
+	if rec.FrameCount() != 3 {
+		t.Fatalf("expected unchanged frames to be merged but got %d frames", rec.FrameCount())
+	}
+	if got := rec.anim.Delay[2]; got != 2*opts.Delay {
+		t.Fatalf("expected merged frame to last %d but got %d", 2*opts.Delay, got)
+	}
+
+	var buf bytes.Buffer
+	if err := rec.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("could not decode recorded gif: %v", err)
+	}
+	if len(decoded.Image) != 3 {
+		t.Fatalf("expected 3 frames written but got %d", len(decoded.Image))
+	}
+	if decoded.Delay[2] != opts.FinalDelay {
+		t.Fatalf("expected last frame held for %d but got %d", opts.FinalDelay, decoded.Delay[2])
+	}
+}
+
+func TestRenderPaletted(t *testing.T) {
+	grid := utils.NewGrid(1, 2)
+	utils.RemoveWalls(grid[0][0], grid[0][1])
+
+	img := RenderPaletted(grid, 4, 1, GetPalettes()["mono"])
+	if img.Rect != image.Rect(0, 0, 8, 4) {
+		t.Fatalf("expected an 8x4 image but got %v", img.Rect)
+	}
+
+	// border all round, nothing where the wall between the tiles was
+	for x := range 8 {
+		if img.ColorIndexAt(x, 0) != wallIndex || img.ColorIndexAt(x, 3) != wallIndex {
+			t.Fatalf("expected top and bottom walls at x %d", x)
+		}
+	}
+	if img.ColorIndexAt(0, 1) != wallIndex || img.ColorIndexAt(7, 1) != wallIndex {
+		t.Fatal("expected left and right walls")
+	}
+	if img.ColorIndexAt(3, 1) != backgroundIndex || img.ColorIndexAt(4, 2) != backgroundIndex {
+		t.Fatal("expected no wall between the open tiles")
+	}
+}
+
+func TestDiffAndCrop(t *testing.T) {
+	palette := GetPalettes()["mono"]
+	a := image.NewPaletted(image.Rect(0, 0, 10, 8), palette)
+	b := image.NewPaletted(image.Rect(0, 0, 10, 8), palette)
+	if got := diffBounds(a, b); !got.Empty() {
+		t.Fatalf("expected identical frames to have no difference but got %v", got)
+	}
+
+	b.SetColorIndex(2, 3, wallIndex)
+	b.SetColorIndex(6, 5, wallIndex)
+	if got := diffBounds(a, b); got != image.Rect(2, 3, 7, 6) {
+		t.Fatalf("expected dirty rectangle (2,3)-(7,6) but got %v", got)
+	}
+
+	// give every pixel its own value so a wrong stride or offset shows up
+	for y := range 8 {
+		for x := range 10 {
+			b.Pix[y*b.Stride+x] = uint8(y*10 + x)
+		}
+	}
+	rect := image.Rect(3, 2, 7, 5)
+	cropped := cropPaletted(b, rect)
+	if cropped.Rect != rect || cropped.Stride != 4 {
+		t.Fatalf("expected crop of %v with stride 4 but got %v with stride %d", rect, cropped.Rect, cropped.Stride)
+	}
+	if cropped.Pix[0] != 23 {
+		t.Fatalf("expected crop to start at (3,2) but got pixel %d", cropped.Pix[0])
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if cropped.ColorIndexAt(x, y) != b.ColorIndexAt(x, y) {
+				t.Fatalf("cropped pixel (%d,%d) is %d but was %d", x, y, cropped.ColorIndexAt(x, y), b.ColorIndexAt(x, y))
+			}
+		}
+	}
+}
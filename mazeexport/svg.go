@@ -0,0 +1,210 @@
+// Package mazeexport renders maze grids into formats meant for use outside the game, such as printable vector images
+package mazeexport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+// PageSize is a paper size in millimetres. The zero value means no page fitting.
+type PageSize struct {
+	Name   string
+	Width  float64
+	Height float64
+}
+
+var (
+	PageNone   = PageSize{}
+	PageA4     = PageSize{Name: "a4", Width: 210, Height: 297}
+	PageLetter = PageSize{Name: "letter", Width: 215.9, Height: 279.4}
+)
+
+func GetPageSizes() map[string]PageSize {
+	return map[string]PageSize{
+		"none":   PageNone,
+		"a4":     PageA4,
+		"letter": PageLetter,
+	}
+}
+
+type SVGOptions struct {
+	// CellSize is the size of each tile in user units. Ignored when Page is set.
+	CellSize float64
+	// StrokeWidth is in output units: mm when Page is set, user units otherwise.
+	StrokeWidth      float64
+	WallColour       color.Color
+	BackgroundColour color.Color // nil leaves the background transparent
+	SolutionColour   color.Color
+	Solution         []*utils.Tile
+	Page             PageSize
+	// Margin around the maze in mm. Only used when Page is set.
+	Margin float64
+	// RoundCaps rounds off wall ends instead of squaring them
+	RoundCaps bool
+}
+
+func DefaultSVGOptions() SVGOptions {
+	return SVGOptions{
+		CellSize:       20,
+		StrokeWidth:    2,
+		WallColour:     color.Black,
+		SolutionColour: color.RGBA{220, 40, 40, 255},
+		Margin:         10,
+	}
+}
+
+func SaveSVG(grid utils.Grid, opts SVGOptions, fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %v", fileName, err)
+	}
+
+	if err := WriteSVG(file, grid, opts); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func WriteSVG(w io.Writer, grid utils.Grid, opts SVGOptions) error {
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return errors.New("cannot export empty grid")
+	}
+
+	topo := grid.Topology()
+	gridW, gridH := topo.Size(len(grid), grid.Cols())
+
+	// scale maps tile widths onto output coordinates
+	var width, height, scale, offsetX, offsetY float64
+	if opts.Page != PageNone {
+		var err error
+		width, height, scale, err = fitToPage(gridW, gridH, opts.Page, opts.Margin)
+		if err != nil {
+			return err
+		}
+		offsetX = (width - scale*gridW) / 2
+		offsetY = (height - scale*gridH) / 2
+	} else {
+		if opts.CellSize <= 0 {
+			return errors.New("cell size must be positive")
+		}
+		scale = opts.CellSize
+		// pad by half a stroke so border walls are not clipped
+		offsetX, offsetY = opts.StrokeWidth/2, opts.StrokeWidth/2
+		width = scale*gridW + opts.StrokeWidth
+		height = scale*gridH + opts.StrokeWidth
+	}
+
+	toX := func(x float64) float64 { return offsetX + x*scale }
+	toY := func(y float64) float64 { return offsetY + y*scale }
+
+	bw := bufio.NewWriter(w)
+
+	if opts.Page != PageNone {
+		fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%smm" height="%smm" viewBox="0 0 %s %s">`+"\n",
+			num(width), num(height), num(width), num(height))
+	} else {
+		fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s">`+"\n",
+			num(width), num(height), num(width), num(height))
+	}
+
+	if opts.BackgroundColour != nil {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"%s/>`+"\n",
+			svgColour(opts.BackgroundColour), svgOpacity("fill-opacity", opts.BackgroundColour))
+	}
+
+	linecap := "square"
+	if opts.RoundCaps {
+		linecap = "round"
+	}
+	fmt.Fprintf(bw, `<g stroke="%s"%s stroke-width="%s" stroke-linecap="%s" fill="none">`+"\n",
+		svgColour(opts.WallColour), svgOpacity("stroke-opacity", opts.WallColour), num(opts.StrokeWidth), linecap)
+	for _, s := range wallSegments(grid) {
+		if s.radius == 0 {
+			fmt.Fprintf(bw, `<line x1="%s" y1="%s" x2="%s" y2="%s"/>`+"\n",
+				num(toX(s.x1)), num(toY(s.y1)), num(toX(s.x2)), num(toY(s.y2)))
+			continue
+		}
+
+		// walls are never more than half a circle, so the sweep is just which way round the short way goes
+		sweep := 0
+		if (s.x1-s.cx)*(s.y2-s.cy)-(s.y1-s.cy)*(s.x2-s.cx) > 0 {
+			sweep = 1
+		}
+		fmt.Fprintf(bw, `<path d="M%s %sA%s %s 0 0 %d %s %s"/>`+"\n",
+			num(toX(s.x1)), num(toY(s.y1)), num(s.radius*scale), num(s.radius*scale), sweep, num(toX(s.x2)), num(toY(s.y2)))
+	}
+	fmt.Fprintln(bw, "</g>")
+
+	if len(opts.Solution) > 0 {
+		fmt.Fprintf(bw, `<polyline stroke="%s"%s stroke-width="%s" stroke-linecap="round" stroke-linejoin="round" fill="none" points="`,
+			svgColour(opts.SolutionColour), svgOpacity("stroke-opacity", opts.SolutionColour), num(opts.StrokeWidth))
+		for i, t := range opts.Solution {
+			if i > 0 {
+				fmt.Fprint(bw, " ")
+			}
+			// polyline runs through tile centres
+			x, y := topo.Centre(t)
+			fmt.Fprintf(bw, "%s,%s", num(toX(x)), num(toY(y)))
+		}
+		fmt.Fprintln(bw, `"/>`)
+	}
+
+	fmt.Fprintln(bw, "</svg>")
+
+	return bw.Flush()
+}
+
+// fitToPage picks the orientation giving the largest maze and returns page width, height and the size of one tile, all in mm
+func fitToPage(gridW, gridH float64, page PageSize, margin float64) (float64, float64, float64, error) {
+	// margins eat the page from both sides, so anything at half the page or more leaves no room for the maze
+	if page.Width-2*margin <= 0 || page.Height-2*margin <= 0 {
+		return 0, 0, 0, fmt.Errorf("margin of %smm leaves no room on a %smm x %smm page", num(margin), num(page.Width), num(page.Height))
+	}
+
+	fit := func(w, h float64) float64 {
+		return min((w-2*margin)/gridW, (h-2*margin)/gridH)
+	}
+
+	portrait := fit(page.Width, page.Height)
+	landscape := fit(page.Height, page.Width)
+	if landscape > portrait {
+		return page.Height, page.Width, landscape, nil
+	}
+
+	return page.Width, page.Height, portrait, nil
+}
+
+func svgColour(c color.Color) string {
+	if c == nil {
+		return "none"
+	}
+
+	rgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B)
+}
+
+func svgOpacity(attr string, c color.Color) string {
+	if c == nil {
+		return ""
+	}
+
+	rgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if rgba.A == 255 {
+		return ""
+	}
+
+	return fmt.Sprintf(` %s="%s"`, attr, num(float64(rgba.A)/255))
+}
+
+// num formats floats compactly so output stays small and diffable
+func num(f float64) string {
+	return fmt.Sprintf("%.6g", f)
+}
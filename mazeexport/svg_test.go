@@ -0,0 +1,120 @@
+package mazeexport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+func TestSVGMergesWallsAndDrawsSolution(t *testing.T) {
+	// two rows of three with a wall between (0,1) and (0,2)
+	grid := utils.NewGrid(2, 3)
+	utils.RemoveWalls(grid[0][0], grid[0][1])
+	utils.RemoveWalls(grid[0][1], grid[1][1])
+	utils.RemoveWalls(grid[0][2], grid[1][2])
+	utils.RemoveWalls(grid[1][0], grid[1][1])
+	utils.RemoveWalls(grid[1][1], grid[1][2])
+
+	opts := DefaultSVGOptions()
+	opts.Solution = utils.Solve(grid, grid[0][0], grid[0][2])
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, grid, opts); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	// three horizontal runs, one of them only a tile long, and three vertical ones
+	if got := strings.Count(out, "<line "); got != 6 {
+		t.Fatalf("expected walls merged into 6 lines but got %d", got)
+	}
+	if !strings.Contains(out, `<line x1="1" y1="21" x2="21" y2="21"/>`) {
+		t.Fatalf("expected the short wall under (0,0) in\n%s", out)
+	}
+
+	// the route has to go down and round the wall between (0,1) and (0,2)
+	if !strings.Contains(out, `points="11,11 31,11 31,31 51,31 51,11"`) {
+		t.Fatalf("expected solution through tile centres in\n%s", out)
+	}
+}
+
+func TestSVGFitsPage(t *testing.T) {
+	grid := utils.NewGrid(10, 20)
+	opts := DefaultSVGOptions()
+	opts.Page = PageA4
+
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, grid, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// a wide maze fits A4 better on its side
+	if !strings.Contains(buf.String(), `width="297mm" height="210mm"`) {
+		t.Fatalf("expected a landscape A4 page but got\n%s", buf.String()[:120])
+	}
+	if strings.Contains(buf.String(), "<polyline") {
+		t.Fatal("expected no solution without one being asked for")
+	}
+
+	// margins meeting in the middle of the page leave nowhere to draw
+	opts.Margin = PageA4.Width / 2
+	if err := WriteSVG(&bytes.Buffer{}, grid, opts); err == nil {
+		t.Fatal("expected an error when the margins fill the page")
+	}
+}
+
+func TestHexExports(t *testing.T) {
+	grid := utils.NewGridOf(utils.Hex, 3, 4)
+	topo := grid.Topology()
+
+	// a fresh grid has every inner wall plus every side facing off the grid
+	want := int(topo.InnerWalls(3, 4))
+	for _, row := range grid {
+		for _, tile := range row {
+			for side := range topo.Sides(tile) {
+				r, c := topo.Neighbour(tile, side)
+				if r < 0 || r >= len(grid) || c < 0 || c >= len(grid[r]) {
+					want++
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, grid, DefaultSVGOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "<line "); got != want {
+		t.Fatalf("expected %d wall lines but got %d", want, got)
+	}
+
+	// 4.5 tiles across, and rows overlap by a quarter of a hex so 3 rows are 2.89 tiles tall
+	img := RenderPaletted(grid, 10, 1, GetPalettes()["mono"])
+	if img.Rect.Dx() != 45 || img.Rect.Dy() != 29 {
+		t.Fatalf("expected image to fit the hex grid but got %v", img.Rect)
+	}
+}
+
+func TestPolarExports(t *testing.T) {
+	grid := utils.NewGridOf(utils.Polar, 3, 0)
+
+	// rings of 1, 6 and 12 tiles. Each tile outside the centre has a straight wall clockwise,
+	// and the outward walls are arcs, 6 round the centre then 12 and 24 round the other rings
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, grid, DefaultSVGOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "<line "); got != 18 {
+		t.Fatalf("expected 18 straight walls but got %d", got)
+	}
+	if got := strings.Count(buf.String(), "<path "); got != 42 {
+		t.Fatalf("expected 42 curved walls but got %d", got)
+	}
+
+	// a circle one tile across per ring
+	img := RenderPaletted(grid, 10, 1, GetPalettes()["mono"])
+	if img.Rect.Dx() != 60 || img.Rect.Dy() != 60 {
+		t.Fatalf("expected image to fit the polar grid but got %v", img.Rect)
+	}
+}
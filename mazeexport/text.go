@@ -0,0 +1,233 @@
+package mazeexport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+// box drawing glyphs indexed by which arms leave the junction: up=1, right=2, down=4, left=8
+var junctions = [16]string{
+	" ", "╵", "╶", "└", "╷", "│", "┌", "├",
+	"╴", "┘", "─", "┴", "┐", "┤", "┬", "┼",
+}
+
+// ToASCII renders the grid in the classic +--+ style. Each tile is three characters wide and two lines tall.
+// Only square grids can be drawn this way, anything else gives an empty string.
+func ToASCII(grid utils.Grid) string {
+	if len(grid) == 0 || len(grid[0]) == 0 || grid.Topology() != utils.Square {
+		return ""
+	}
+
+	numRows, numCols := len(grid), len(grid[0])
+	var sb strings.Builder
+
+	for r := 0; r <= numRows; r++ {
+		for c := 0; c < numCols; c++ {
+			sb.WriteString("+")
+			if horizontalWall(grid, r, c) {
+				sb.WriteString("--")
+			} else {
+				sb.WriteString("  ")
+			}
+		}
+		sb.WriteString("+\n")
+
+		if r == numRows {
+			break
+		}
+
+		for c := 0; c <= numCols; c++ {
+			if verticalWall(grid, r, c) {
+				sb.WriteString("|")
+			} else {
+				sb.WriteString(" ")
+			}
+			if c < numCols {
+				sb.WriteString("  ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// ToUnicode renders the grid with box drawing characters, picking the junction glyph that matches the walls meeting at each corner.
+// Layout matches ToASCII so the two can be compared line by line, and like it only square grids are drawn.
+func ToUnicode(grid utils.Grid) string {
+	if len(grid) == 0 || len(grid[0]) == 0 || grid.Topology() != utils.Square {
+		return ""
+	}
+
+	numRows, numCols := len(grid), len(grid[0])
+	var sb strings.Builder
+
+	for r := 0; r <= numRows; r++ {
+		for c := 0; c <= numCols; c++ {
+			var arms int
+			if r > 0 && verticalWall(grid, r-1, c) {
+				arms |= 1
+			}
+			if c < numCols && horizontalWall(grid, r, c) {
+				arms |= 2
+			}
+			if r < numRows && verticalWall(grid, r, c) {
+				arms |= 4
+			}
+			if c > 0 && horizontalWall(grid, r, c-1) {
+				arms |= 8
+			}
+			sb.WriteString(junctions[arms])
+
+			if c == numCols {
+				break
+			}
+
+			if horizontalWall(grid, r, c) {
+				sb.WriteString("──")
+			} else {
+				sb.WriteString("  ")
+			}
+		}
+		sb.WriteString("\n")
+
+		if r == numRows {
+			break
+		}
+
+		for c := 0; c <= numCols; c++ {
+			if verticalWall(grid, r, c) {
+				sb.WriteString("│")
+			} else {
+				sb.WriteString(" ")
+			}
+			if c < numCols {
+				sb.WriteString("  ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// ParseASCII reads a maze in the format produced by ToASCII. Trailing blank lines and carriage returns are ignored.
+func ParseASCII(text string) (utils.Grid, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) < 3 || len(lines)%2 == 0 {
+		return nil, fmt.Errorf("expected an odd number of lines, at least 3, but got %d", len(lines))
+	}
+
+	width := len(lines[0])
+	if width < 4 || (width-1)%3 != 0 {
+		return nil, fmt.Errorf("line 1: width %d is not a whole number of tiles", width)
+	}
+
+	numRows, numCols := (len(lines)-1)/2, (width-1)/3
+	grid := utils.NewGrid(numRows, numCols)
+
+	for i, line := range lines {
+		// pad lines whose trailing open walls were trimmed by an editor
+		if len(line) < width {
+			line += strings.Repeat(" ", width-len(line))
+		} else if len(line) > width {
+			return nil, fmt.Errorf("line %d: expected width %d but got %d", i+1, width, len(line))
+		}
+
+		r := i / 2
+		if i%2 == 0 {
+			if err := parseBoundaryLine(grid, line, r); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		} else {
+			if err := parseCellLine(grid, line, r); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+	}
+
+	return grid, nil
+}
+
+// parseBoundaryLine handles a +--+ line lying above row r
+func parseBoundaryLine(grid utils.Grid, line string, r int) error {
+	numRows := len(grid)
+
+	for c := range grid[0] {
+		if line[3*c] != '+' {
+			return fmt.Errorf("column %d: expected '+' but got %q", 3*c+1, line[3*c])
+		}
+
+		var wall bool
+		switch line[3*c+1 : 3*c+3] {
+		case "--":
+			wall = true
+		case "  ":
+			wall = false
+		default:
+			return fmt.Errorf("column %d: expected \"--\" or \"  \" but got %q", 3*c+2, line[3*c+1:3*c+3])
+		}
+
+		if wall {
+			continue
+		}
+
+		switch r {
+		case 0:
+			grid[r][c].SetWall(utils.North, false)
+		case numRows:
+			grid[r-1][c].SetWall(utils.South, false)
+		default:
+			utils.RemoveWalls(grid[r-1][c], grid[r][c])
+		}
+	}
+
+	if line[len(line)-1] != '+' {
+		return errors.New("expected line to end with '+'")
+	}
+
+	return nil
+}
+
+// parseCellLine handles a |  | line for row r
+func parseCellLine(grid utils.Grid, line string, r int) error {
+	numCols := len(grid[0])
+
+	for c := 0; c <= numCols; c++ {
+		var wall bool
+		switch line[3*c] {
+		case '|':
+			wall = true
+		case ' ':
+			wall = false
+		default:
+			return fmt.Errorf("column %d: expected '|' or ' ' but got %q", 3*c+1, line[3*c])
+		}
+
+		if c < numCols && line[3*c+1:3*c+3] != "  " {
+			return fmt.Errorf("column %d: expected tile interior to be blank", 3*c+2)
+		}
+
+		if wall {
+			continue
+		}
+
+		switch c {
+		case 0:
+			grid[r][c].SetWall(utils.West, false)
+		case numCols:
+			grid[r][c-1].SetWall(utils.East, false)
+		default:
+			utils.RemoveWalls(grid[r][c-1], grid[r][c])
+		}
+	}
+
+	return nil
+}
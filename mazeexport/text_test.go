@@ -0,0 +1,80 @@
+package mazeexport
+
+import (
+	"testing"
+
+	"github.com/bailey4770/gomazing/generators/dfs"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/bailey4770/gomazing/utils/mazetest"
+)
+
+const fixture = `+--+--+--+
+|     |  |
++--+  +  +
+|        |
++--+--+--+
+`
+
+func TestParseAndRenderASCII(t *testing.T) {
+	grid, err := ParseASCII(fixture)
+	if err != nil {
+		t.Fatalf("could not parse fixture: %v", err)
+	}
+
+	if len(grid) != 2 || len(grid[0]) != 3 {
+		t.Fatalf("expected 2x3 grid but got %dx%d", len(grid), len(grid[0]))
+	}
+	if grid[0][0].Wall(utils.East) || grid[0][1].Wall(utils.West) {
+		t.Fatal("expected passage between (0,0) and (0,1)")
+	}
+	if !grid[0][1].Wall(utils.East) || !grid[0][2].Wall(utils.West) {
+		t.Fatal("expected wall between (0,1) and (0,2)")
+	}
+
+	if got := ToASCII(grid); got != fixture {
+		t.Fatalf("round trip mismatch:\nexpected\n%s\ngot\n%s", fixture, got)
+	}
+
+	expectedUnicode := `┌─────┬──┐
+│     │  │
+├──╴  ╵  │
+│        │
+└────────┘
+`
+	if got := ToUnicode(grid); got != expectedUnicode {
+		t.Fatalf("unicode mismatch:\nexpected\n%s\ngot\n%s", expectedUnicode, got)
+	}
+}
+
+func TestASCIIRoundTripGenerated(t *testing.T) {
+	grid := utils.NewGrid(12, 17)
+	mazetest.Generate(t, dfs.GetMazeState(), grid)
+
+	loaded, err := ParseASCII(ToASCII(grid))
+	if err != nil {
+		t.Fatalf("could not parse rendered maze: %v", err)
+	}
+
+	for i, row := range grid {
+		for j, tile := range row {
+			if *loaded[i][j] != *tile {
+				t.Fatalf("tile (%d,%d) does not match after round trip", i, j)
+			}
+		}
+	}
+}
+
+func TestParseASCIIRejectsMalformed(t *testing.T) {
+	cases := map[string]string{
+		"too few lines": "+--+\n",
+		"ragged width":  "+--+--+\n|     |\n+--+\n",
+		"bad junction":  "+--*\n|  |\n+--+\n",
+		"bad wall":      "+--+\n#  |\n+--+\n",
+	}
+
+	for name, text := range cases {
+		if _, err := ParseASCII(text); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
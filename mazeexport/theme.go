@@ -0,0 +1,24 @@
+package mazeexport
+
+import (
+	"image/color"
+
+	"github.com/bailey4770/gomazing/theme"
+)
+
+// ThemedSVGOptions is DefaultSVGOptions in t's colours and cap style
+func ThemedSVGOptions(t theme.Theme) SVGOptions {
+	opts := DefaultSVGOptions()
+	opts.WallColour = t.Wall
+	opts.BackgroundColour = t.Background
+	opts.SolutionColour = t.Path
+	opts.RoundCaps = t.Caps == theme.CapsRound
+	return opts
+}
+
+// ThemePalette is a gif palette of t's background and walls. Gif frames are opaque so any alpha is dropped.
+func ThemePalette(t theme.Theme) color.Palette {
+	background, wall := t.Background, t.Wall
+	background.A, wall.A = 255, 255
+	return color.Palette{background, wall}
+}
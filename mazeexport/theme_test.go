@@ -0,0 +1,35 @@
+package mazeexport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bailey4770/gomazing/theme"
+	"github.com/bailey4770/gomazing/utils"
+)
+
+func TestThemedSVG(t *testing.T) {
+	th := theme.GetThemes()["blueprint"]
+
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, utils.NewGrid(2, 3), ThemedSVGOptions(th)); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+
+	for _, want := range []string{
+		`stroke-linecap="round"`,
+		`fill="` + svgColour(th.Background) + `"`,
+		`stroke="` + svgColour(th.Wall) + `"`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("expected themed svg to contain %s", want)
+		}
+	}
+
+	palette := ThemePalette(th)
+	if palette[backgroundIndex] != (theme.GetThemes()["blueprint"].Background) || len(palette) != 2 {
+		t.Fatalf("expected palette to start with the theme background but got %v", palette)
+	}
+}
@@ -0,0 +1,117 @@
+package mazeexport
+
+import (
+	"slices"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+// segment is a run of wall in tile widths. Curved walls go the short way round the circle centred on (cx, cy),
+// straight ones have a radius of 0.
+type segment struct {
+	x1, y1, x2, y2 float64
+	cx, cy, radius float64
+}
+
+// points runs along s with no more than step between points
+func (s segment) points(step float64) [][2]float64 {
+	if s.radius == 0 {
+		return [][2]float64{{s.x1, s.y1}, {s.x2, s.y2}}
+	}
+	return utils.ArcPoints(s.cx, s.cy, s.x1, s.y1, s.x2, s.y2, step)
+}
+
+// wallSegments lists every wall in the grid once. Square walls are merged into long runs,
+// other topologies get one segment per wall.
+func wallSegments(grid utils.Grid) []segment {
+	topo := grid.Topology()
+	if topo == utils.Square {
+		return mergeWalls(grid)
+	}
+
+	curved, _ := topo.(utils.Curved)
+	var segments []segment
+	for _, row := range grid {
+		for _, t := range row {
+			for side := range topo.Sides(t) {
+				if !t.Wall(side) {
+					continue
+				}
+
+				// walls between two tiles are only kept by the tile owning that side
+				r, c := topo.Neighbour(t, side)
+				onGrid := r >= 0 && r < len(grid) && c >= 0 && c < len(grid[r])
+				if onGrid && !slices.Contains(topo.Forward(t), side) {
+					continue
+				}
+
+				s := segment{}
+				s.x1, s.y1 = topo.Corner(t, side)
+				s.x2, s.y2 = topo.Corner(t, side+1)
+				if s.x1 == s.x2 && s.y1 == s.y2 {
+					// the polar centre has sides with no length
+					continue
+				}
+				if curved != nil {
+					s.cx, s.cy, s.radius, _ = curved.Arc(t, side)
+				}
+				segments = append(segments, s)
+			}
+		}
+	}
+
+	return segments
+}
+
+// horizontalWall reports whether there is a wall along the top edge of tile (r, c).
+// r may equal len(grid) to ask about the bottom border.
+func horizontalWall(grid utils.Grid, r, c int) bool {
+	numRows := len(grid)
+	return (r < numRows && grid[r][c].Wall(utils.North)) || (r > 0 && grid[r-1][c].Wall(utils.South))
+}
+
+// verticalWall reports whether there is a wall along the left edge of tile (r, c).
+// c may equal len(grid[0]) to ask about the right border.
+func verticalWall(grid utils.Grid, r, c int) bool {
+	numCols := len(grid[0])
+	return (c < numCols && grid[r][c].Wall(utils.West)) || (c > 0 && grid[r][c-1].Wall(utils.East))
+}
+
+// mergeWalls walks every horizontal and vertical grid line and joins adjacent wall edges into single runs.
+// Coordinates are grid lattice points, so (col, row) of the tile corners.
+func mergeWalls(grid utils.Grid) []segment {
+	numRows, numCols := len(grid), len(grid[0])
+	var segments []segment
+
+	// horizontal lines sit above row r (r == numRows is the bottom edge)
+	for r := 0; r <= numRows; r++ {
+		start := -1
+		for c := 0; c <= numCols; c++ {
+			wall := c < numCols && horizontalWall(grid, r, c)
+
+			if wall && start < 0 {
+				start = c
+			} else if !wall && start >= 0 {
+				segments = append(segments, segment{x1: float64(start), y1: float64(r), x2: float64(c), y2: float64(r)})
+				start = -1
+			}
+		}
+	}
+
+	// vertical lines sit left of col c (c == numCols is the right edge)
+	for c := 0; c <= numCols; c++ {
+		start := -1
+		for r := 0; r <= numRows; r++ {
+			wall := r < numRows && verticalWall(grid, r, c)
+
+			if wall && start < 0 {
+				start = r
+			} else if !wall && start >= 0 {
+				segments = append(segments, segment{x1: float64(c), y1: float64(start), x2: float64(c), y2: float64(r)})
+				start = -1
+			}
+		}
+	}
+
+	return segments
+}
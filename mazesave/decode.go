@@ -0,0 +1,450 @@
+package mazesave
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+// Decode errors. Check with errors.Is, the returned error is a *DecodeError wrapping one of these.
+var (
+	ErrTruncated     = errors.New("maze data is truncated")
+	ErrBadMagic      = errors.New("not a maze file")
+	ErrBadVersion    = errors.New("unsupported maze format version")
+	ErrBadDimensions = errors.New("bad maze dimensions")
+	ErrBadMetadata   = errors.New("bad maze metadata")
+	ErrBadWalls      = errors.New("bad wall data")
+	ErrChecksum      = errors.New("checksum mismatch")
+)
+
+// DecodeError says where in the stream decoding stopped and why
+type DecodeError struct {
+	// Offset is the number of bytes consumed when the problem was found
+	Offset  int64
+	Section string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding %s at byte %d: %v", e.Section, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	sectionHeader   = "header"
+	sectionMetadata = "metadata"
+	sectionWalls    = "walls"
+	sectionChecksum = "checksum"
+)
+
+// maxMetaString guards against allocating huge buffers for a corrupt length
+const maxMetaString = 1 << 16
+
+type header struct {
+	version     byte
+	compression Compression
+	topology    utils.Topology
+	numRows     int
+	numCols     int
+	meta        Meta
+}
+
+// reader is what the decoder needs. Anything else gets wrapped in a bufio.Reader.
+type reader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Decode reads a whole maze in one pass, allocating the grid itself. Both legacy v1 and current files are accepted.
+// If r does not implement io.ByteReader it is buffered, so Decode may read past the end of the maze.
+//
+// Malformed input never panics. Wall data and checksum are fully read and verified before the grid is allocated,
+// and compressed walls stop inflating once they pass a few KB plus maxInflateRatio times the compressed bytes read
+// so far, so a big grid needs a correspondingly big input.
+func Decode(r io.Reader) (utils.Grid, Meta, error) {
+	tr := &trackingReader{r: asReader(r), checksum: crc32.NewIEEE()}
+
+	h, err := readHeader(tr)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+
+	if h.version == legacyVersion {
+		return decodeLegacyBody(tr, h)
+	}
+
+	data, err := readWallBytes(tr, h)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+
+	sum := tr.checksum.Sum32()
+	var stored uint32
+	if err := binary.Read(tr, binary.LittleEndian, &stored); err != nil {
+		return nil, Meta{}, tr.fail(sectionChecksum, err)
+	}
+	if stored != sum {
+		return nil, Meta{}, tr.errorf(sectionChecksum, ErrChecksum, "stored %08x but computed %08x", stored, sum)
+	}
+
+	grid := utils.NewGridOf(h.topology, h.numRows, h.numCols)
+	applyWalls(grid, data)
+
+	return grid, h.meta, nil
+}
+
+// DecodeHeader reads only as far as the metadata, for listing mazes without loading their walls
+func DecodeHeader(r io.Reader) (int, int, Meta, error) {
+	h, err := readHeader(&trackingReader{r: asReader(r), checksum: crc32.NewIEEE()})
+	if err != nil {
+		return 0, 0, Meta{}, err
+	}
+
+	return h.numRows, h.numCols, h.meta, nil
+}
+
+// readHeader works out the format version and reads everything before the wall bits
+func readHeader(tr *trackingReader) (header, error) {
+	h := header{topology: utils.Square}
+
+	var first [4]byte
+	if _, err := io.ReadFull(tr, first[:]); err != nil {
+		return header{}, tr.fail(sectionHeader, err)
+	}
+
+	if first != magic {
+		// no magic, so this can only be a file written before versioning existed.
+		// The bytes already read are the first two dimensions.
+		h.version = legacyVersion
+		if err := readLegacyDimensions(io.MultiReader(bytes.NewReader(first[:]), tr), &h); err != nil {
+			return header{}, tr.legacyFail(sectionHeader, err)
+		}
+		return h, nil
+	}
+
+	version, err := tr.ReadByte()
+	if err != nil {
+		return header{}, tr.fail(sectionHeader, err)
+	}
+	h.version = version
+	if h.version < uint16Version || h.version > currentVersion {
+		return header{}, tr.errorf(sectionHeader, ErrBadVersion, "version %d", h.version)
+	}
+
+	if h.version >= currentVersion {
+		compression, err := tr.ReadByte()
+		if err != nil {
+			return header{}, tr.fail(sectionHeader, err)
+		}
+		h.compression = Compression(compression)
+		if h.compression != CompressionNone && h.compression != CompressionFlate {
+			return header{}, tr.errorf(sectionHeader, ErrBadWalls, "unknown compression %d", compression)
+		}
+	}
+
+	if h.version >= varintVersion {
+		var dims [3]uint64
+		for i := range dims {
+			var err error
+			if dims[i], err = binary.ReadUvarint(tr); err != nil {
+				return header{}, tr.fail(sectionHeader, err)
+			}
+			// check before converting so huge values cannot wrap around int
+			if dims[i] > MaxDimension {
+				return header{}, tr.errorf(sectionHeader, ErrBadDimensions, "dimension %d is larger than the maximum of %d", dims[i], MaxDimension)
+			}
+		}
+		h.numRows, h.numCols, h.meta.TileSize = int(dims[0]), int(dims[1]), int(dims[2])
+
+		if err := ValidateDimensions(h.numRows, h.numCols, h.meta.TileSize); err != nil {
+			return header{}, tr.fail(sectionHeader, err)
+		}
+	} else if err := readLegacyDimensions(tr, &h); err != nil {
+		return header{}, tr.fail(sectionHeader, err)
+	}
+
+	if err := readMeta(tr, &h.meta, &h.topology); err != nil {
+		return header{}, tr.fail(sectionMetadata, err)
+	}
+	if err := ValidateTopology(h.topology, h.numRows, h.numCols); err != nil {
+		return header{}, tr.fail(sectionMetadata, err)
+	}
+	if err := checkPositions(h); err != nil {
+		return header{}, tr.fail(sectionMetadata, err)
+	}
+
+	return h, nil
+}
+
+// readLegacyDimensions reads the three uint16 dimensions used by v1 and v2
+func readLegacyDimensions(r io.Reader, h *header) error {
+	var dims [3]uint16
+	if err := binary.Read(r, binary.LittleEndian, &dims); err != nil {
+		return err
+	}
+
+	h.numRows, h.numCols, h.meta.TileSize = int(dims[0]), int(dims[1]), int(dims[2])
+	return ValidateDimensions(h.numRows, h.numCols, h.meta.TileSize)
+}
+
+// decodeLegacyBody reads v1 walls. With no magic or checksum the only sanity check left is that
+// the data ends exactly where the dimensions say it should, so anything else is reported as ErrBadMagic.
+func decodeLegacyBody(tr *trackingReader, h header) (utils.Grid, Meta, error) {
+	numBytes := (h.topology.InnerWalls(h.numRows, h.numCols) + 7) / 8
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, tr, numBytes); err != nil {
+		return nil, Meta{}, tr.legacyFail(sectionWalls, err)
+	}
+	if _, err := tr.ReadByte(); err == nil {
+		return nil, Meta{}, tr.legacyFail(sectionWalls, errors.New("unexpected data after walls"))
+	} else if !errors.Is(err, io.EOF) {
+		return nil, Meta{}, tr.fail(sectionWalls, err)
+	}
+
+	grid := utils.NewGrid(h.numRows, h.numCols)
+	applyWalls(grid, buf.Bytes())
+
+	return grid, h.meta, nil
+}
+
+// readWallBytes reads the packed wall bits, inflating them if needed. The buffer grows with the data actually
+// received, so a header claiming a huge maze fails with ErrTruncated before anything large is allocated.
+// Flate can turn a few bytes into megabytes, so inflating stops with ErrBadWalls once it passes inflateLimit
+// for the compressed bytes read so far.
+func readWallBytes(tr *trackingReader, h header) ([]byte, error) {
+	numBytes := (h.topology.InnerWalls(h.numRows, h.numCols) + 7) / 8
+
+	if h.compression == CompressionNone {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, tr, numBytes); err != nil {
+			return nil, tr.fail(sectionWalls, err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	// flate reads exactly its own stream because trackingReader is an io.ByteReader,
+	// so the checksum that follows is left for us
+	start := tr.offset
+	fr := flate.NewReader(tr)
+	defer func() {
+		_ = fr.Close()
+	}()
+
+	var buf bytes.Buffer
+	for int64(buf.Len()) < numBytes {
+		allowed := min(numBytes, inflateLimit(tr.offset-start)) - int64(buf.Len())
+		if allowed <= 0 {
+			return nil, tr.errorf(sectionWalls, ErrBadWalls, "%d compressed bytes inflate to more than %d bytes of walls",
+				tr.offset-start, buf.Len())
+		}
+
+		n, err := io.Copy(&buf, io.LimitReader(fr, allowed))
+		if err != nil {
+			return nil, tr.fail(sectionWalls, err)
+		}
+		if n == 0 {
+			return nil, tr.fail(sectionWalls, io.ErrUnexpectedEOF)
+		}
+	}
+
+	// the compressed stream must end here, reading one more byte finds its end marker
+	var extra [1]byte
+	if n, err := fr.Read(extra[:]); n > 0 {
+		return nil, tr.errorf(sectionWalls, ErrBadWalls, "more wall data than the dimensions allow")
+	} else if !errors.Is(err, io.EOF) {
+		return nil, tr.fail(sectionWalls, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func readMeta(r reader, meta *Meta, topology *utils.Topology) error {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+
+	readString := func() (string, error) {
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		if length > maxMetaString {
+			return "", fmt.Errorf("%w: string of length %d is too long", ErrBadMetadata, length)
+		}
+
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+
+	for range count {
+		key, err := readString()
+		if err != nil {
+			return err
+		}
+		value, err := readString()
+		if err != nil {
+			return err
+		}
+
+		// unknown keys are skipped so newer files still open
+		switch key {
+		case keyAlgorithm:
+			meta.Algorithm = value
+		case keyTopology:
+			topo, ok := utils.GetTopologies()[value]
+			if !ok {
+				return fmt.Errorf("%w: unknown topology %q", ErrBadMetadata, value)
+			}
+			*topology = topo
+		case keyName:
+			meta.Name = value
+		case keyDescription:
+			meta.Description = value
+		case keyTags:
+			if value != "" {
+				meta.Tags = strings.Split(value, ",")
+			}
+		case keySeed:
+			if meta.Seed, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("%w: bad seed: %v", ErrBadMetadata, err)
+			}
+		case keyStart:
+			if meta.Start, err = parsePosition(value); err != nil {
+				return fmt.Errorf("%w: bad start: %v", ErrBadMetadata, err)
+			}
+		case keyGoal:
+			if meta.Goal, err = parsePosition(value); err != nil {
+				return fmt.Errorf("%w: bad goal: %v", ErrBadMetadata, err)
+			}
+		case keyCreated:
+			if meta.Created, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return fmt.Errorf("%w: bad created time: %v", ErrBadMetadata, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkPositions(h header) error {
+	for _, p := range []Position{h.meta.Start, h.meta.Goal} {
+		if p.Row < 0 || p.Row >= h.numRows || p.Col < 0 || p.Col >= h.topology.Cols(p.Row, h.numCols) {
+			return fmt.Errorf("%w: position (%d,%d) is outside the maze", ErrBadMetadata, p.Row, p.Col)
+		}
+	}
+	return nil
+}
+
+// applyWalls knocks down every wall whose bit is clear. data must hold one bit per inner wall.
+func applyWalls(grid utils.Grid, data []byte) {
+	topo := grid.Topology()
+
+	var bit int
+	readBit := func() bool {
+		// shift byte to right by bit position, then AND to see if bit in buffer is 1
+		wall := (data[bit/8]>>(bit%8))&1 == 1
+		bit++
+		return wall
+	}
+
+	for _, row := range grid {
+		for _, tile := range row {
+			for _, side := range topo.Forward(tile) {
+				if !onGrid(grid, topo, tile, side) {
+					continue
+				}
+				if !readBit() {
+					r, c := topo.Neighbour(tile, side)
+					utils.RemoveWalls(tile, grid[r][c])
+				}
+			}
+		}
+	}
+}
+
+func parsePosition(s string) (Position, error) {
+	rowStr, colStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return Position{}, fmt.Errorf("expected row,col but got %q", s)
+	}
+
+	row, err := strconv.Atoi(rowStr)
+	if err != nil {
+		return Position{}, err
+	}
+	col, err := strconv.Atoi(colStr)
+	if err != nil {
+		return Position{}, err
+	}
+
+	return Position{Row: row, Col: col}, nil
+}
+
+func asReader(r io.Reader) reader {
+	if rr, ok := r.(reader); ok {
+		return rr
+	}
+	return bufio.NewReader(r)
+}
+
+// trackingReader feeds every byte it hands out into a running crc32 and counts them for error offsets
+type trackingReader struct {
+	r        reader
+	checksum hash.Hash32
+	offset   int64
+}
+
+func (t *trackingReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.checksum.Write(p[:n])
+	t.offset += int64(n)
+	return n, err
+}
+
+func (t *trackingReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.checksum.Write([]byte{b})
+		t.offset++
+	}
+	return b, err
+}
+
+// fail wraps err for the section it happened in, turning any kind of early EOF into ErrTruncated
+func (t *trackingReader) fail(section string, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return &DecodeError{Offset: t.offset, Section: section, Err: err}
+}
+
+func (t *trackingReader) errorf(section string, kind error, format string, args ...any) error {
+	return &DecodeError{Offset: t.offset, Section: section, Err: fmt.Errorf("%w: %s", kind, fmt.Sprintf(format, args...))}
+}
+
+// legacyFail reports a file with no magic that also failed to parse as v1. Both ErrBadMagic and
+// the underlying cause match with errors.Is.
+func (t *trackingReader) legacyFail(section string, err error) error {
+	decodeErr := t.fail(section, err).(*DecodeError)
+	decodeErr.Err = fmt.Errorf("%w, and not a valid legacy file: %w", ErrBadMagic, decodeErr.Err)
+	return decodeErr
+}
@@ -0,0 +1,294 @@
+package mazesave
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+const jsonVersion = 1
+
+type Position struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+// Meta describes how a maze was made. Formats that cannot store a field leave it as the zero value.
+type Meta struct {
+	TileSize  int
+	Algorithm string
+	Seed      int64
+	Start     Position
+	Goal      Position
+	Created   time.Time
+	Name      string
+	// Description and Tags are free text the user attaches when saving
+	Description string
+	Tags        []string
+}
+
+// NewMeta fills in defaults for a freshly generated maze: start top left, goal bottom right, created now.
+// Polar mazes start in the centre and finish at the end of the outer ring.
+func NewMeta(grid utils.Grid, tileSize int) Meta {
+	return Meta{
+		TileSize: tileSize,
+		Start:    Position{Row: 0, Col: 0},
+		Goal:     Position{Row: len(grid) - 1, Col: grid.Cols() - 1},
+		Created:  time.Now().UTC(),
+	}
+}
+
+// Endpoints returns where play starts and ends on grid. Legacy files and files saved without positions have
+// Start and Goal both at (0,0), so they get the defaults from NewMeta instead.
+func (m Meta) Endpoints(grid utils.Grid) (Position, Position) {
+	if m.Start == m.Goal {
+		defaults := NewMeta(grid, m.TileSize)
+		return defaults.Start, defaults.Goal
+	}
+
+	return m.Start, m.Goal
+}
+
+// jsonWalls maps side names to whether that side is walled
+type jsonWalls map[string]bool
+
+// sideNames are the JSON keys for each side, in the topology's side order. Polar tiles only use as many
+// of theirs as they have sides.
+var sideNames = map[utils.Shape][]string{
+	utils.ShapeSquare: {"n", "e", "s", "w"},
+	utils.ShapeHex:    {"e", "se", "sw", "w", "nw", "ne"},
+	utils.ShapePolar:  {"cw", "in", "ccw", "out1", "out2", "out3", "out4", "out5", "out6"},
+}
+
+func tileSideNames(topo utils.Topology, t *utils.Tile) []string {
+	return sideNames[topo.Shape()][:topo.Sides(t)]
+}
+
+type jsonMaze struct {
+	Version int `json:"version"`
+	// Topology is left out for square mazes
+	Topology    string        `json:"topology,omitempty"`
+	Rows        int           `json:"rows"`
+	Cols        int           `json:"cols"`
+	TileSize    int           `json:"tileSize"`
+	Algorithm   string        `json:"algorithm,omitempty"`
+	Seed        int64         `json:"seed"`
+	Start       Position      `json:"start"`
+	Goal        Position      `json:"goal"`
+	Created     time.Time     `json:"created,omitzero"`
+	Name        string        `json:"name,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+	Walls       [][]jsonWalls `json:"walls"`
+}
+
+func IsJSON(filePath string) bool {
+	return strings.EqualFold(filepath.Ext(filePath), ".json")
+}
+
+func EncodeJSON(w io.Writer, grid utils.Grid, meta Meta) error {
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return errors.New("cannot save empty grid")
+	}
+	if err := ValidateDimensions(len(grid), grid.Cols(), meta.TileSize); err != nil {
+		return err
+	}
+
+	topo := grid.Topology()
+	maze := jsonMaze{
+		Version:     jsonVersion,
+		Rows:        len(grid),
+		Cols:        grid.Cols(),
+		TileSize:    meta.TileSize,
+		Algorithm:   meta.Algorithm,
+		Seed:        meta.Seed,
+		Start:       meta.Start,
+		Goal:        meta.Goal,
+		Created:     meta.Created,
+		Name:        meta.Name,
+		Description: meta.Description,
+		Tags:        meta.Tags,
+		Walls:       make([][]jsonWalls, len(grid)),
+	}
+	if topo != utils.Square {
+		maze.Topology = topo.Name()
+	}
+
+	for i, row := range grid {
+		maze.Walls[i] = make([]jsonWalls, len(row))
+		for j, tile := range row {
+			names := tileSideNames(topo, tile)
+			walls := make(jsonWalls, len(names))
+			for side, name := range names {
+				walls[name] = tile.Wall(side)
+			}
+			maze.Walls[i][j] = walls
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(maze); err != nil {
+		return fmt.Errorf("could not encode maze: %v", err)
+	}
+
+	return nil
+}
+
+func DecodeJSON(r io.Reader) (utils.Grid, Meta, error) {
+	var maze jsonMaze
+	if err := json.NewDecoder(r).Decode(&maze); err != nil {
+		return nil, Meta{}, fmt.Errorf("could not decode maze: %v", err)
+	}
+
+	if maze.Version != jsonVersion {
+		return nil, Meta{}, fmt.Errorf("unsupported json maze version %d", maze.Version)
+	}
+	if err := ValidateDimensions(maze.Rows, maze.Cols, maze.TileSize); err != nil {
+		return nil, Meta{}, err
+	}
+
+	topo := utils.Square
+	if maze.Topology != "" {
+		var ok bool
+		if topo, ok = utils.GetTopologies()[maze.Topology]; !ok {
+			return nil, Meta{}, fmt.Errorf("unknown topology %q", maze.Topology)
+		}
+	}
+
+	if err := ValidateTopology(topo, maze.Rows, maze.Cols); err != nil {
+		return nil, Meta{}, err
+	}
+
+	// the wall rows have to match the header before anything is allocated for them
+	if len(maze.Walls) != maze.Rows {
+		return nil, Meta{}, fmt.Errorf("%w: expected %d rows of walls but got %d", ErrBadWalls, maze.Rows, len(maze.Walls))
+	}
+	for i, row := range maze.Walls {
+		if numCols := topo.Cols(i, maze.Cols); len(row) != numCols {
+			return nil, Meta{}, fmt.Errorf("%w: row %d: expected %d tiles but got %d", ErrBadWalls, i, numCols, len(row))
+		}
+	}
+
+	grid := utils.NewGridOf(topo, maze.Rows, maze.Cols)
+	for i, row := range maze.Walls {
+		for j, walls := range row {
+			tile := grid[i][j]
+			for side, name := range tileSideNames(topo, tile) {
+				wall, ok := walls[name]
+				if !ok {
+					return nil, Meta{}, fmt.Errorf("%w: tile (%d,%d) has no %s wall", ErrBadWalls, i, j, name)
+				}
+				tile.SetWall(side, wall)
+			}
+		}
+	}
+
+	if err := checkWallsAgree(grid); err != nil {
+		return nil, Meta{}, err
+	}
+
+	meta := Meta{
+		TileSize:    maze.TileSize,
+		Algorithm:   maze.Algorithm,
+		Seed:        maze.Seed,
+		Start:       maze.Start,
+		Goal:        maze.Goal,
+		Created:     maze.Created,
+		Name:        maze.Name,
+		Description: maze.Description,
+		Tags:        maze.Tags,
+	}
+
+	for _, p := range []Position{meta.Start, meta.Goal} {
+		if p.Row < 0 || p.Row >= maze.Rows || p.Col < 0 || p.Col >= len(grid[p.Row]) {
+			return nil, Meta{}, fmt.Errorf("position (%d,%d) is outside the maze", p.Row, p.Col)
+		}
+	}
+
+	return grid, meta, nil
+}
+
+func SaveMazeJSON(grid utils.Grid, meta Meta, fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %v", fileName, err)
+	}
+
+	if err := EncodeJSON(file, grid, meta); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// BinaryToJSON converts a .maze file into JSON. Legacy v1 files get default start and goal positions.
+func BinaryToJSON(src, dst string) error {
+	grid, meta, err := LoadMaze(src)
+	if err != nil {
+		return err
+	}
+
+	meta.Start, meta.Goal = meta.Endpoints(grid)
+
+	return SaveMazeJSON(grid, meta, dst)
+}
+
+// JSONToBinary converts a JSON maze into a .maze file. The binary format always has a closed border,
+// so mazes with openings in the border are rejected rather than silently changed.
+func JSONToBinary(src, dst string) error {
+	grid, meta, err := LoadMaze(src)
+	if err != nil {
+		return err
+	}
+
+	if !hasClosedBorder(grid) {
+		return errors.New("binary format cannot store openings in the outer wall")
+	}
+
+	return SaveMaze(grid, meta, dst)
+}
+
+// checkWallsAgree makes sure both sides of every interior wall say the same thing
+func checkWallsAgree(grid utils.Grid) error {
+	topo := grid.Topology()
+	for i, row := range grid {
+		for j, tile := range row {
+			for _, side := range topo.Forward(tile) {
+				if !onGrid(grid, topo, tile, side) {
+					continue
+				}
+
+				r, c := topo.Neighbour(tile, side)
+				if tile.Wall(side) != utils.HasWall(grid[r][c], tile) {
+					return fmt.Errorf("tiles (%d,%d) and (%d,%d) disagree about their shared wall", i, j, r, c)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasClosedBorder(grid utils.Grid) bool {
+	topo := grid.Topology()
+	for _, row := range grid {
+		for _, tile := range row {
+			for side := range topo.Sides(tile) {
+				if !onGrid(grid, topo, tile, side) && !tile.Wall(side) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
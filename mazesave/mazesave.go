@@ -2,83 +2,201 @@
 package mazesave
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bailey4770/gomazing/utils"
 )
 
-func SaveMaze(grid utils.Grid, tileSize int, fileName string) error {
-	file, err := os.Create(fileName)
-	if err != nil {
-		return fmt.Errorf("could not create file %s: %v", fileName, err)
+// Format v4 layout, fixed width integers little endian:
+//
+//	magic       "GMAZ"
+//	version     1 byte
+//	compression 1 byte, see Compression
+//	numRows     uvarint
+//	numCols     uvarint
+//	tileSize    uvarint
+//	metadata    uvarint count, then count pairs of uvarint length prefixed key and value strings
+//	walls       each tile's forward walls in order, east then south for square mazes, one bit each,
+//	            packed lsb first, then compressed. Walls on the border are not stored.
+//	checksum    crc32 (IEEE) of every byte above as stored
+//
+// v3 had no compression byte. v2 also stored the three dimensions as uint16. Legacy v1 files are the
+// v2 layout minus magic, version, metadata and checksum.
+var magic = [4]byte{'G', 'M', 'A', 'Z'}
+
+const (
+	legacyVersion  = 1
+	uint16Version  = 2
+	varintVersion  = 3
+	currentVersion = 4
+)
+
+// Compression selects how the wall bits are stored
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionFlate
+)
+
+// wallChunk is how many packed wall bytes are buffered before each write
+const wallChunk = 4096
+
+// Flate can inflate around a thousand times, so without a limit a few KB of valid data could claim a maze
+// needing gigabytes. Real mazes compress far less than maxInflateRatio, and minInflateLimit leaves room for
+// the start of a stream, where flate's headers make the ratio meaningless.
+const (
+	maxInflateRatio = 64
+	minInflateLimit = 4 << 10
+)
+
+const (
+	// MaxDimension is the most rows or cols a maze may have
+	MaxDimension = 1 << 20
+	// MaxTiles caps rows*cols. Decoding still needs the walls of every tile to be in the input before allocating.
+	MaxTiles = 1 << 28
+	// MaxTileSize is the largest tile size in pixels
+	MaxTileSize = 1 << 12
+)
+
+const (
+	keyAlgorithm   = "algorithm"
+	keySeed        = "seed"
+	keyStart       = "start"
+	keyGoal        = "goal"
+	keyCreated     = "created"
+	keyName        = "name"
+	keyDescription = "description"
+	keyTags        = "tags"
+	// keyTopology is only written for mazes that are not square, so square files read the same as ever
+	keyTopology = "topology"
+)
+
+// Encode writes the grid and its metadata in the current binary format without compression
+func Encode(w io.Writer, grid utils.Grid, meta Meta) error {
+	return EncodeCompressed(w, grid, meta, CompressionNone)
+}
+
+// EncodeCompressed is Encode with the wall bits compressed. Worth it for archives, the header stays readable either way.
+// Walls so regular that Decode would refuse to inflate them, like a huge maze with every wall up, are left uncompressed.
+func EncodeCompressed(w io.Writer, grid utils.Grid, meta Meta, compression Compression) error {
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return errors.New("cannot save empty grid")
 	}
+	if compression != CompressionNone && compression != CompressionFlate {
+		return fmt.Errorf("unknown compression %d", compression)
+	}
+
+	// compress first, since walls too regular for the decoder to accept are stored as they are
+	var compressed bytes.Buffer
+	if compression == CompressionFlate {
+		fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+		if err != nil {
+			return fmt.Errorf("could not create compressor: %v", err)
+		}
+		if err := writeWalls(fw, grid); err != nil {
+			return err
+		}
+		if err := fw.Close(); err != nil {
+			return fmt.Errorf("could not finish compressing walls: %v", err)
+		}
+
+		// inflate it again under the decoder's limits, since a file it would refuse is no use to anyone
+		tr := &trackingReader{r: bytes.NewReader(compressed.Bytes()), checksum: crc32.NewIEEE()}
+		h := header{compression: compression, topology: grid.Topology(), numRows: len(grid), numCols: grid.Cols()}
+		if _, err := readWallBytes(tr, h); err != nil {
+			compression = CompressionNone
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	checksum := crc32.NewIEEE()
+	mw := io.MultiWriter(bw, checksum)
 
-	numRows, numCols := len(grid), len(grid[0])
-	if err := binary.Write(file, binary.LittleEndian, uint16(numRows)); err != nil {
-		return fmt.Errorf("could not write numRows to file: %v", err)
+	if _, err := mw.Write(magic[:]); err != nil {
+		return fmt.Errorf("could not write magic: %v", err)
 	}
-	if err := binary.Write(file, binary.LittleEndian, uint16(numCols)); err != nil {
-		return fmt.Errorf("could not write numCols to file: %v", err)
+	if _, err := mw.Write([]byte{currentVersion, byte(compression)}); err != nil {
+		return fmt.Errorf("could not write version: %v", err)
 	}
 
-	if err := binary.Write(file, binary.LittleEndian, uint16(tileSize)); err != nil {
-		return fmt.Errorf("could not write tileSize to file: %v", err)
+	numRows, numCols := len(grid), grid.Cols()
+	if err := ValidateDimensions(numRows, numCols, meta.TileSize); err != nil {
+		return err
+	}
+	if err := ValidateTopology(grid.Topology(), numRows, numCols); err != nil {
+		return err
 	}
 
-	var bitBuffer byte
-	var bitPos uint
+	dims := binary.AppendUvarint(nil, uint64(numRows))
+	dims = binary.AppendUvarint(dims, uint64(numCols))
+	dims = binary.AppendUvarint(dims, uint64(meta.TileSize))
+	if _, err := mw.Write(dims); err != nil {
+		return fmt.Errorf("could not write dimensions: %v", err)
+	}
 
-	writeBit := func(wall bool) error {
-		if wall {
-			bitBuffer |= (1 << bitPos)
-		}
-		bitPos++
+	if err := writeMeta(mw, meta, grid.Topology()); err != nil {
+		return fmt.Errorf("could not write metadata: %v", err)
+	}
 
-		if bitPos == 8 {
-			// we have filled up byte
-			if _, err := file.Write([]byte{bitBuffer}); err != nil {
-				return err
-			}
-			bitBuffer, bitPos = 0, 0
+	if compression == CompressionFlate {
+		if _, err := compressed.WriteTo(mw); err != nil {
+			return fmt.Errorf("could not write walls: %v", err)
 		}
+	} else if err := writeWalls(mw, grid); err != nil {
+		return err
+	}
 
-		return nil
+	if err := binary.Write(bw, binary.LittleEndian, checksum.Sum32()); err != nil {
+		return fmt.Errorf("could not write checksum: %v", err)
 	}
 
-	for i, row := range grid {
-		for j, tile := range row {
-			// Write east wall (except for final col)
-			if j < numCols-1 {
-				if err := writeBit(tile.WallE); err != nil {
-					return fmt.Errorf("could not write tile WallE to buffer: %v", err)
-				}
-			}
+	return bw.Flush()
+}
 
-			// Write south wall (except for final row)
-			if i < numRows-1 {
-				if err := writeBit(tile.WallS); err != nil {
-					return fmt.Errorf("could not write tile WallS to buffer: %v", err)
-				}
-			}
-		}
+// inflateLimit is how many bytes of walls may come from compressed bytes of flate data
+func inflateLimit(compressed int64) int64 {
+	return minInflateLimit + compressed*maxInflateRatio
+}
+
+// SaveMaze writes the binary format to fileName
+func SaveMaze(grid utils.Grid, meta Meta, fileName string) error {
+	return SaveMazeCompressed(grid, meta, fileName, CompressionNone)
+}
+
+func SaveMazeCompressed(grid utils.Grid, meta Meta, fileName string, compression Compression) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %v", fileName, err)
 	}
 
-	if bitPos > 0 {
-		if _, err := file.Write([]byte{bitBuffer}); err != nil {
-			return err
-		}
+	if err := EncodeCompressed(file, grid, meta, compression); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not save maze to %s: %v", fileName, err)
 	}
 
-	return nil
+	return file.Close()
 }
 
-func GetMazeDimensions(filepath string) (int, int, int, error) {
+// LoadMaze reads a maze file in either the binary or JSON format, chosen by file extension
+func LoadMaze(filepath string) (utils.Grid, Meta, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("could not read from %s: %v", filepath, err)
+		return nil, Meta{}, fmt.Errorf("could not read from %s: %v", filepath, err)
 	}
 	defer func() {
 		err := file.Close()
@@ -87,24 +205,41 @@ func GetMazeDimensions(filepath string) (int, int, int, error) {
 		}
 	}()
 
-	var numRows, numCols, tileSize uint16
-	if err := binary.Read(file, binary.LittleEndian, &numRows); err != nil {
-		return 0, 0, 0, fmt.Errorf("could not read numRows: %v", err)
+	if IsJSON(filepath) {
+		return DecodeJSON(file)
 	}
-	if err := binary.Read(file, binary.LittleEndian, &numCols); err != nil {
-		return 0, 0, 0, fmt.Errorf("could not read numCols: %v", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &tileSize); err != nil {
-		return 0, 0, 0, fmt.Errorf("could not read tileSize: %v", err)
+
+	return Decode(file)
+}
+
+func GetMazeDimensions(filepath string) (int, int, int, error) {
+	numRows, numCols, meta, err := readFileHeader(filepath)
+	if err != nil {
+		return 0, 0, 0, err
 	}
 
-	return int(numRows), int(numCols), int(tileSize), nil
+	return numRows, numCols, meta.TileSize, nil
+}
+
+// LoadMazeMeta reads just the metadata section. Legacy files only carry the tile size.
+func LoadMazeMeta(filepath string) (Meta, error) {
+	_, _, meta, err := readFileHeader(filepath)
+	return meta, err
 }
 
-func LoadMazeWalls(filepath string, grid utils.Grid) error {
+func readFileHeader(filepath string) (int, int, Meta, error) {
+	if IsJSON(filepath) {
+		// json has no separate header, so this has to read everything
+		grid, meta, err := LoadMaze(filepath)
+		if err != nil {
+			return 0, 0, Meta{}, err
+		}
+		return len(grid), grid.Cols(), meta, nil
+	}
+
 	file, err := os.Open(filepath)
 	if err != nil {
-		return fmt.Errorf("could not read from %s: %v", filepath, err)
+		return 0, 0, Meta{}, fmt.Errorf("could not read from %s: %v", filepath, err)
 	}
 	defer func() {
 		err := file.Close()
@@ -113,54 +248,180 @@ func LoadMazeWalls(filepath string, grid utils.Grid) error {
 		}
 	}()
 
-	// Skip past firsrt 6 bytes (dimension info already read)
-	var offset int64 = 6
-	if _, err := file.Seek(offset, 0); err != nil {
-		return fmt.Errorf("could not seek: %v", err)
+	return DecodeHeader(file)
+}
+
+// ValidateDimensions checks a maze fits the format limits. A tile size of 0 is allowed for mazes with no preferred size.
+func ValidateDimensions(numRows, numCols, tileSize int) error {
+	if numRows < 1 || numRows > MaxDimension {
+		return fmt.Errorf("%w: rows must be between 1 and %d but got %d", ErrBadDimensions, MaxDimension, numRows)
+	}
+	if numCols < 1 || numCols > MaxDimension {
+		return fmt.Errorf("%w: cols must be between 1 and %d but got %d", ErrBadDimensions, MaxDimension, numCols)
+	}
+	if numRows*numCols > MaxTiles {
+		return fmt.Errorf("%w: %dx%d maze has more than the maximum of %d tiles", ErrBadDimensions, numRows, numCols, MaxTiles)
+	}
+	if tileSize < 0 || tileSize > MaxTileSize {
+		return fmt.Errorf("%w: tile size must be between 0 and %d but got %d", ErrBadDimensions, MaxTileSize, tileSize)
+	}
+
+	return nil
+}
+
+// ValidateTopology checks the dimensions suit topo. Polar mazes are a number of rings with cols the length
+// of the outer ring, which is fixed by how many rings there are.
+func ValidateTopology(topo utils.Topology, numRows, numCols int) error {
+	if topo.Shape() == utils.ShapePolar && numRows > utils.MaxRings {
+		return fmt.Errorf("%w: polar mazes can have at most %d rings but got %d", ErrBadDimensions, utils.MaxRings, numRows)
+	}
+	if want := topo.Cols(numRows-1, numCols); numCols != want {
+		return fmt.Errorf("%w: a %s maze with %d rows has %d cols but got %d", ErrBadDimensions, topo.Name(), numRows, want, numCols)
 	}
 
-	numRows := len(grid)
-	numCols := len(grid[0])
+	return nil
+}
 
-	var bitBuffer byte
-	var bitPos uint = 8 // so we kick off with full bitBuffer
-	readBits := func() (bool, error) {
-		if bitPos == 8 {
-			if err := binary.Read(file, binary.LittleEndian, &bitBuffer); err != nil {
-				return false, fmt.Errorf("could not read from file: %v", err)
+// Hash identifies a maze by its dimensions and walls alone, so the same maze saved under another name,
+// in another format or with different metadata hashes the same
+func Hash(grid utils.Grid) (string, error) {
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return "", errors.New("cannot hash empty grid")
+	}
+
+	h := sha256.New()
+	dims := binary.AppendUvarint(nil, uint64(len(grid)))
+	dims = binary.AppendUvarint(dims, uint64(grid.Cols()))
+	h.Write(dims)
+	// square mazes hash as they did before there were other topologies
+	if topo := grid.Topology(); topo != utils.Square {
+		h.Write([]byte(topo.Name()))
+	}
+
+	if err := writeWalls(h, grid); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PuzzleHash is Hash plus where the route starts and ends, since moving either makes a different puzzle
+// out of the same walls. Mazes using the start and goal from NewMeta get their plain Hash.
+func PuzzleHash(grid utils.Grid, start, goal Position) (string, error) {
+	hash, err := Hash(grid)
+	if err != nil {
+		return "", err
+	}
+
+	meta := NewMeta(grid, 0)
+	if start == meta.Start && goal == meta.Goal {
+		return hash, nil
+	}
+
+	h := sha256.New()
+	h.Write([]byte(hash))
+	h.Write([]byte(formatPosition(start) + ";" + formatPosition(goal)))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeMeta(w io.Writer, meta Meta, topo utils.Topology) error {
+	pairs := [][2]string{
+		{keyAlgorithm, meta.Algorithm},
+		{keySeed, strconv.FormatInt(meta.Seed, 10)},
+		{keyStart, formatPosition(meta.Start)},
+		{keyGoal, formatPosition(meta.Goal)},
+		{keyName, meta.Name},
+	}
+	if topo != utils.Square {
+		pairs = append(pairs, [2]string{keyTopology, topo.Name()})
+	}
+	if !meta.Created.IsZero() {
+		pairs = append(pairs, [2]string{keyCreated, meta.Created.Format(time.RFC3339Nano)})
+	}
+	if meta.Description != "" {
+		pairs = append(pairs, [2]string{keyDescription, meta.Description})
+	}
+	if len(meta.Tags) > 0 {
+		for _, tag := range meta.Tags {
+			if tag == "" || strings.Contains(tag, ",") {
+				return fmt.Errorf("%w: tag %q must be non-empty and cannot contain ','", ErrBadMetadata, tag)
 			}
-			bitPos = 0
 		}
+		pairs = append(pairs, [2]string{keyTags, strings.Join(meta.Tags, ",")})
+	}
 
-		// shift byte to right by bitPos, then AND to see if bit in buffer is 1
-		bit := (bitBuffer >> bitPos) & 1
-		bitPos++
-		return bit == 1, nil
+	buf := binary.AppendUvarint(nil, uint64(len(pairs)))
+	for _, pair := range pairs {
+		for _, s := range pair {
+			buf = binary.AppendUvarint(buf, uint64(len(s)))
+			buf = append(buf, s...)
+		}
 	}
 
-	for i, row := range grid {
-		for j, tile := range row {
-			// read next bit as bool for east wall (so long as we aren't in final col)
-			if j < numCols-1 {
-				wall, err := readBits()
-				if err != nil {
+	_, err := w.Write(buf)
+	return err
+}
+
+func writeWalls(w io.Writer, grid utils.Grid) error {
+	topo := grid.Topology()
+
+	buf := make([]byte, 0, wallChunk)
+	var bitBuffer byte
+	var bitPos uint
+
+	writeBit := func(wall bool) error {
+		if wall {
+			bitBuffer |= (1 << bitPos)
+		}
+		bitPos++
+
+		if bitPos == 8 {
+			// we have filled up byte
+			buf = append(buf, bitBuffer)
+			bitBuffer, bitPos = 0, 0
+
+			if len(buf) == wallChunk {
+				if _, err := w.Write(buf); err != nil {
 					return err
-				} else if !wall {
-					utils.RemoveWalls(tile, row[j+1])
 				}
+				buf = buf[:0]
 			}
+		}
 
-			// read next bit as bool for south wall (so long as we aren't in final row)
-			if i < numRows-1 {
-				wall, err := readBits()
-				if err != nil {
-					return err
-				} else if !wall {
-					utils.RemoveWalls(tile, grid[i+1][j])
+		return nil
+	}
+
+	for _, row := range grid {
+		for _, tile := range row {
+			for _, side := range topo.Forward(tile) {
+				// border walls are always there so are not stored
+				if !onGrid(grid, topo, tile, side) {
+					continue
+				}
+				if err := writeBit(tile.Wall(side)); err != nil {
+					return fmt.Errorf("could not write tile wall to buffer: %v", err)
 				}
 			}
 		}
 	}
 
+	if bitPos > 0 {
+		buf = append(buf, bitBuffer)
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("could not write walls: %v", err)
+	}
+
 	return nil
 }
+
+func formatPosition(p Position) string {
+	return fmt.Sprintf("%d,%d", p.Row, p.Col)
+}
+
+// onGrid reports whether there is a tile across side of tile
+func onGrid(grid utils.Grid, topo utils.Topology, tile *utils.Tile, side int) bool {
+	row, col := topo.Neighbour(tile, side)
+	return row >= 0 && row < len(grid) && col >= 0 && col < len(grid[row])
+}
@@ -1,17 +1,31 @@
 package mazesave
 
 import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"hash/crc32"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
+	"github.com/bailey4770/gomazing/generators/dfs"
+	"github.com/bailey4770/gomazing/generators/kruskals"
 	"github.com/bailey4770/gomazing/generators/prims"
 	"github.com/bailey4770/gomazing/utils"
+	"github.com/bailey4770/gomazing/utils/mazetest"
 )
 
+var huge = flag.Bool("huge", false, "also round trip a 10,000 x 10,000 maze (needs roughly 12 GB of memory)")
+
 func TestSaveAndLoad(t *testing.T) {
 	savedNumRows, savedNumCols, savedTileSize := 10, 10, 2
-	savedGrid := initGrid(savedNumRows, savedNumCols, savedTileSize)
+	savedGrid := initGrid(savedNumRows, savedNumCols)
 	mazeState := prims.GetMazeState()
 
 	err := mazeState.Initialise(savedGrid)
@@ -34,7 +48,7 @@ func TestSaveAndLoad(t *testing.T) {
 		}
 	}()
 
-	err = SaveMaze(savedGrid, savedTileSize, filePath)
+	err = SaveMaze(savedGrid, NewMeta(savedGrid, savedTileSize), filePath)
 	if err != nil {
 		t.Fatal("could not save maze:", err)
 	}
@@ -51,46 +65,566 @@ func TestSaveAndLoad(t *testing.T) {
 		t.Fatalf("expected numCols to be %d but got %d", savedNumCols, loadedNumRows)
 	}
 
-	loadedGrid := initGrid(loadedNumRows, loadedNumCols, loadedTileSize)
-
-	err = LoadMazeWalls(filePath, loadedGrid)
+	loadedGrid, loadedMeta, err := LoadMaze(filePath)
 	if err != nil {
 		t.Fatalf("could not load maze walls: %v", err)
 	}
+	if loadedMeta.TileSize != loadedTileSize {
+		t.Fatalf("expected tileSize to be %d but got %d", loadedTileSize, loadedMeta.TileSize)
+	}
 
 	for i, row := range loadedGrid {
 		for j, loadedTile := range row {
 			savedTile := savedGrid[i][j]
 
-			if loadedTile.WallN != savedTile.WallN {
-				t.Fatal("loaded wall does not match saved wall")
-			}
-			if loadedTile.WallE != savedTile.WallE {
-				t.Fatal("loaded wall does not match saved wall")
-			}
-			if loadedTile.WallS != savedTile.WallS {
-				t.Fatal("loaded wall does not match saved wall")
-			}
-			if loadedTile.WallW != savedTile.WallW {
+			if loadedTile.Walls != savedTile.Walls {
 				t.Fatal("loaded wall does not match saved wall")
 			}
 		}
 	}
 }
 
-func initGrid(maxRows, maxCols, tileSize int) utils.Grid {
+func initGrid(maxRows, maxCols int) utils.Grid {
 	// allocate row slices
 	grid := make(utils.Grid, maxRows)
 
 	for row := range grid {
 		grid[row] = make([]*utils.Tile, maxCols)
-		posY := float64(row * tileSize)
-
 		for col := range grid[row] {
-			posX := float64(col * tileSize)
-			grid[row][col] = utils.CreateTile(posX, posY, row, col)
+			grid[row][col] = utils.CreateTile(row, col)
 		}
 	}
 
 	return grid
 }
+
+func TestJSONRoundTripAndConvert(t *testing.T) {
+	numRows, numCols, tileSize := 8, 12, 5
+	savedGrid := initGrid(numRows, numCols)
+	mazetest.Generate(t, prims.GetMazeState(), savedGrid)
+
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "test.json")
+	binaryPath := filepath.Join(dir, "test.maze")
+	convertedPath := filepath.Join(dir, "converted.json")
+
+	meta := NewMeta(savedGrid, tileSize)
+	meta.Algorithm = "prims"
+	meta.Seed = 42
+
+	if err := SaveMazeJSON(savedGrid, meta, jsonPath); err != nil {
+		t.Fatalf("could not save json maze: %v", err)
+	}
+
+	loadedGrid, loadedMeta, err := LoadMaze(jsonPath)
+	if err != nil {
+		t.Fatalf("could not load json maze: %v", err)
+	}
+	if loadedMeta.Algorithm != "prims" || loadedMeta.Seed != 42 || loadedMeta.TileSize != tileSize {
+		t.Fatalf("metadata did not survive round trip: %+v", loadedMeta)
+	}
+	if !loadedMeta.Created.Equal(meta.Created) || loadedMeta.Goal != meta.Goal {
+		t.Fatalf("metadata did not survive round trip: %+v", loadedMeta)
+	}
+	compareGrids(t, savedGrid, loadedGrid)
+
+	if err := JSONToBinary(jsonPath, binaryPath); err != nil {
+		t.Fatalf("could not convert json to binary: %v", err)
+	}
+	if err := BinaryToJSON(binaryPath, convertedPath); err != nil {
+		t.Fatalf("could not convert binary to json: %v", err)
+	}
+
+	convertedGrid, _, err := LoadMaze(convertedPath)
+	if err != nil {
+		t.Fatalf("could not load converted maze: %v", err)
+	}
+	compareGrids(t, savedGrid, convertedGrid)
+}
+
+func TestDecodeJSONRejectsBadWalls(t *testing.T) {
+	grid := initGrid(3, 4)
+	var buf bytes.Buffer
+	if err := EncodeJSON(&buf, grid, NewMeta(grid, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func(m *jsonMaze){
+		// a header this size would need millions of tiles if it were allocated before the rows were checked
+		"rows missing": func(m *jsonMaze) { m.Rows, m.Cols = 2000, 2000 },
+		"short row":    func(m *jsonMaze) { m.Walls[1] = m.Walls[1][:3] },
+		"side missing": func(m *jsonMaze) { delete(m.Walls[2][1], "s") },
+	}
+	for name, corrupt := range cases {
+		var maze jsonMaze
+		if err := json.Unmarshal(buf.Bytes(), &maze); err != nil {
+			t.Fatal(err)
+		}
+		corrupt(&maze)
+
+		data, err := json.Marshal(maze)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := DecodeJSON(bytes.NewReader(data)); !errors.Is(err, ErrBadWalls) {
+			t.Fatalf("%s: expected bad walls but got %v", name, err)
+		}
+	}
+}
+
+// TestSeedReproducesMazes checks the seed saved in Meta is enough to build the same maze again
+func TestSeedReproducesMazes(t *testing.T) {
+	hashOf := func(name string, seed int64) string {
+		utils.Seed(seed)
+		var mazeState mazetest.Generator
+		switch name {
+		case "dfs":
+			mazeState = dfs.GetMazeState()
+		case "prims":
+			mazeState = prims.GetMazeState()
+		default:
+			mazeState = kruskals.GetMazeState()
+		}
+
+		grid := initGrid(12, 16)
+		mazetest.Generate(t, mazeState, grid)
+
+		hash, err := Hash(grid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	for _, name := range []string{"dfs", "prims", "kruskals"} {
+		if hashOf(name, 42) != hashOf(name, 42) {
+			t.Fatalf("%s: expected the same seed to give the same maze", name)
+		}
+		if hashOf(name, 42) == hashOf(name, 43) {
+			t.Fatalf("%s: expected different seeds to give different mazes", name)
+		}
+	}
+}
+
+func compareGrids(t *testing.T, expected, actual utils.Grid) {
+	t.Helper()
+
+	if len(expected) != len(actual) || expected.Cols() != actual.Cols() {
+		t.Fatalf("expected %dx%d grid but got %dx%d", len(expected), expected.Cols(), len(actual), actual.Cols())
+	}
+
+	for i, row := range expected {
+		if len(row) != len(actual[i]) {
+			t.Fatalf("expected row %d to have %d tiles but got %d", i, len(row), len(actual[i]))
+		}
+		for j, tile := range row {
+			got := actual[i][j]
+			if tile.Walls != got.Walls || tile.Shape != got.Shape {
+				t.Fatalf("walls of tile (%d,%d) do not match", i, j)
+			}
+		}
+	}
+}
+
+func TestLoadLegacyAndMeta(t *testing.T) {
+	numRows, numCols, tileSize := 6, 9, 4
+	savedGrid := initGrid(numRows, numCols)
+	mazetest.Generate(t, prims.GetMazeState(), savedGrid)
+
+	dir := t.TempDir()
+
+	// v1 files are the three dimensions followed directly by wall bits
+	var legacy bytes.Buffer
+	for _, v := range []uint16{uint16(numRows), uint16(numCols), uint16(tileSize)} {
+		if err := binary.Write(&legacy, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeWalls(&legacy, savedGrid); err != nil {
+		t.Fatal(err)
+	}
+	legacyPath := filepath.Join(dir, "legacy.maze")
+	if err := os.WriteFile(legacyPath, legacy.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedGrid, legacyMeta, err := LoadMaze(legacyPath)
+	if err != nil {
+		t.Fatalf("could not load legacy maze: %v", err)
+	}
+	compareGrids(t, savedGrid, loadedGrid)
+
+	// legacy files carry no positions, so play needs the defaults rather than a start on top of the goal
+	defaults := NewMeta(savedGrid, tileSize)
+	if start, goal := legacyMeta.Endpoints(loadedGrid); start != defaults.Start || goal != defaults.Goal {
+		t.Fatalf("expected default endpoints for a legacy maze but got %+v and %+v", start, goal)
+	}
+
+	meta := NewMeta(savedGrid, tileSize)
+	meta.Algorithm = "prims"
+	meta.Seed = -7
+	meta.Name = "meta test"
+	meta.Description = "has a description"
+	meta.Tags = []string{"easy", "tagged"}
+	currentPath := filepath.Join(dir, "current.maze")
+	if err := SaveMaze(savedGrid, meta, currentPath); err != nil {
+		t.Fatalf("could not save maze: %v", err)
+	}
+
+	loadedMeta, err := LoadMazeMeta(currentPath)
+	if err != nil {
+		t.Fatalf("could not load metadata: %v", err)
+	}
+	if loadedMeta.Algorithm != meta.Algorithm || loadedMeta.Seed != meta.Seed || loadedMeta.Name != meta.Name ||
+		loadedMeta.Description != meta.Description || !slices.Equal(loadedMeta.Tags, meta.Tags) ||
+		loadedMeta.Goal != meta.Goal || !loadedMeta.Created.Equal(meta.Created) {
+		t.Fatalf("expected metadata %+v but got %+v", meta, loadedMeta)
+	}
+
+	// flip one wall bit and the checksum should catch it
+	data, err := os.ReadFile(currentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-5] ^= 1
+	if err := os.WriteFile(currentPath, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadMaze(currentPath); err == nil {
+		t.Fatal("expected checksum error for corrupted file")
+	}
+}
+
+func TestEncodeDecodeStream(t *testing.T) {
+	grid := initGrid(5, 7)
+	mazetest.Generate(t, prims.GetMazeState(), grid)
+
+	// mazes back to back in one stream should decode independently, compressed or not
+	var buf bytes.Buffer
+	for _, compression := range []Compression{CompressionNone, CompressionFlate, CompressionNone} {
+		if err := EncodeCompressed(&buf, grid, NewMeta(grid, 3), compression); err != nil {
+			t.Fatalf("could not encode maze: %v", err)
+		}
+	}
+
+	for range 3 {
+		decoded, meta, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("could not decode maze: %v", err)
+		}
+		if meta.TileSize != 3 {
+			t.Fatalf("expected tileSize 3 but got %d", meta.TileSize)
+		}
+		compareGrids(t, grid, decoded)
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected stream to be consumed but %d bytes remain", buf.Len())
+	}
+}
+
+func TestHexRoundTrip(t *testing.T) {
+	grid := utils.NewGridOf(utils.Hex, 6, 5)
+	mazetest.Generate(t, kruskals.GetMazeState(), grid)
+	meta := NewMeta(grid, 4)
+
+	var buf bytes.Buffer
+	if err := EncodeCompressed(&buf, grid, meta, CompressionFlate); err != nil {
+		t.Fatalf("could not encode maze: %v", err)
+	}
+	decoded, _, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("could not decode maze: %v", err)
+	}
+	compareGrids(t, grid, decoded)
+
+	buf.Reset()
+	if err := EncodeJSON(&buf, grid, meta); err != nil {
+		t.Fatalf("could not encode json: %v", err)
+	}
+	decoded, _, err = DecodeJSON(&buf)
+	if err != nil {
+		t.Fatalf("could not decode json: %v", err)
+	}
+	compareGrids(t, grid, decoded)
+
+	squareHash, err := Hash(utils.NewGrid(6, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hexHash, err := Hash(utils.NewGridOf(utils.Hex, 6, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if squareHash == hexHash {
+		t.Fatal("expected square and hex grids of the same size to hash differently")
+	}
+}
+
+func TestPolarRoundTrip(t *testing.T) {
+	grid := utils.NewGridOf(utils.Polar, 7, 0)
+	mazetest.Generate(t, kruskals.GetMazeState(), grid)
+	meta := NewMeta(grid, 4)
+	if meta.Goal.Col != grid.Cols()-1 {
+		t.Fatalf("expected goal on the outer ring but got %+v", meta.Goal)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeCompressed(&buf, grid, meta, CompressionFlate); err != nil {
+		t.Fatalf("could not encode maze: %v", err)
+	}
+	decoded, _, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("could not decode maze: %v", err)
+	}
+	compareGrids(t, grid, decoded)
+
+	buf.Reset()
+	if err := EncodeJSON(&buf, grid, meta); err != nil {
+		t.Fatalf("could not encode json: %v", err)
+	}
+	decoded, _, err = DecodeJSON(&buf)
+	if err != nil {
+		t.Fatalf("could not decode json: %v", err)
+	}
+	compareGrids(t, grid, decoded)
+
+	// the outer ring of a 7 ring maze has 48 tiles, so any other number of cols is wrong
+	if err := ValidateTopology(utils.Polar, 7, 32); !errors.Is(err, ErrBadDimensions) {
+		t.Fatalf("expected a polar maze with the wrong cols to be rejected but got %v", err)
+	}
+	if err := ValidateTopology(utils.Polar, utils.MaxRings+1, 1); !errors.Is(err, ErrBadDimensions) {
+		t.Fatalf("expected a polar maze with too many rings to be rejected but got %v", err)
+	}
+}
+
+func TestHugeMazeRoundTrip(t *testing.T) {
+	sizes := [][2]int{{70_000, 3}, {2, 100_000}}
+	if *huge {
+		sizes = append(sizes, [2]int{10_000, 10_000})
+	}
+
+	for _, size := range sizes {
+		grid := utils.NewGrid(size[0], size[1])
+		mazetest.Generate(t, kruskals.GetMazeState(), grid)
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, grid, NewMeta(grid, 1)); err != nil {
+			t.Fatalf("%dx%d: could not encode maze: %v", size[0], size[1], err)
+		}
+
+		decoded, _, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%dx%d: could not decode maze: %v", size[0], size[1], err)
+		}
+		compareGrids(t, grid, decoded)
+	}
+}
+
+func TestRejectsOutOfRangeDimensions(t *testing.T) {
+	grid := initGrid(1, 1)
+	if err := Encode(&bytes.Buffer{}, grid, NewMeta(grid, MaxTileSize+1)); !errors.Is(err, ErrBadDimensions) {
+		t.Fatalf("expected bad dimensions for oversized tile but got %v", err)
+	}
+
+	// hand build a header claiming more rows than allowed
+	data := append(magic[:], currentVersion, byte(CompressionNone))
+	data = binary.AppendUvarint(data, MaxDimension+1)
+	data = binary.AppendUvarint(data, 1)
+	data = binary.AppendUvarint(data, 1)
+	if _, _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrBadDimensions) {
+		t.Fatalf("expected bad dimensions for too many rows but got %v", err)
+	}
+}
+
+type benchmarkCase struct {
+	name        string
+	grid        utils.Grid
+	compression Compression
+}
+
+// benchmarkCases pairs each compression with a prims maze (short random passages)
+// and a dfs maze (long corridors), since how well walls compress depends on the algorithm
+func benchmarkCases(b *testing.B) []benchmarkCase {
+	b.Helper()
+
+	generators := []struct {
+		name      string
+		mazeState mazetest.Generator
+	}{{"prims", prims.GetMazeState()}, {"dfs", dfs.GetMazeState()}}
+
+	var cases []benchmarkCase
+	for _, gen := range generators {
+		grid := utils.NewGrid(1000, 1000)
+		mazetest.Generate(b, gen.mazeState, grid)
+
+		cases = append(cases,
+			benchmarkCase{gen.name + "/none", grid, CompressionNone},
+			benchmarkCase{gen.name + "/flate", grid, CompressionFlate},
+		)
+	}
+
+	return cases
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, bc := range benchmarkCases(b) {
+		b.Run(bc.name, func(b *testing.B) {
+			meta := NewMeta(bc.grid, 1)
+			var buf bytes.Buffer
+			for b.Loop() {
+				buf.Reset()
+				if err := EncodeCompressed(&buf, bc.grid, meta, bc.compression); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(buf.Len()), "bytes/maze")
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, bc := range benchmarkCases(b) {
+		b.Run(bc.name, func(b *testing.B) {
+			var buf bytes.Buffer
+			if err := EncodeCompressed(&buf, bc.grid, NewMeta(bc.grid, 1), bc.compression); err != nil {
+				b.Fatal(err)
+			}
+			data := buf.Bytes()
+
+			for b.Loop() {
+				if _, _, err := Decode(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/maze")
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	grid := initGrid(4, 6)
+	var valid bytes.Buffer
+	if err := Encode(&valid, grid, NewMeta(grid, 2)); err != nil {
+		t.Fatal(err)
+	}
+	data := valid.Bytes()
+
+	zeroCols := append(magic[:], currentVersion, byte(CompressionNone))
+	zeroCols = binary.AppendUvarint(zeroCols, 4)
+	zeroCols = binary.AppendUvarint(zeroCols, 0)
+	zeroCols = binary.AppendUvarint(zeroCols, 2)
+
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	// flate of nothing but open walls claiming a size-by-size maze, with a checksum so only the inflate limit can catch it
+	bomb := func(size int) []byte {
+		data := append(magic[:], currentVersion, byte(CompressionFlate))
+		data = binary.AppendUvarint(data, uint64(size))
+		data = binary.AppendUvarint(data, uint64(size))
+		data = binary.AppendUvarint(data, 2)
+		data = binary.AppendUvarint(data, 0)
+		var walls bytes.Buffer
+		fw, err := flate.NewWriter(&walls, flate.BestCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(make([]byte, (utils.Square.InnerWalls(size, size)+7)/8)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, walls.Bytes()...)
+		return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	}
+	// around a KB of input that would otherwise allocate four million tiles
+	if small := bomb(2048); len(small) > 2048 {
+		t.Fatalf("expected a tiny payload but got %d bytes", len(small))
+	}
+
+	cases := []struct {
+		name     string
+		data     []byte
+		expected []error
+	}{
+		{"empty", nil, []error{ErrTruncated}},
+		{"truncated header", data[:6], []error{ErrTruncated}},
+		{"truncated walls", data[:len(data)-6], []error{ErrTruncated}},
+		{"garbage", []byte("hello, this is not a maze"), []error{ErrBadMagic}},
+		{"legacy zero cols", []byte{4, 0, 0, 0, 2, 0}, []error{ErrBadMagic, ErrBadDimensions}},
+		{"zero cols", zeroCols, []error{ErrBadDimensions}},
+		{"future version", append(magic[:], currentVersion+1), []error{ErrBadVersion}},
+		{"corrupt", corrupt, []error{ErrChecksum}},
+		{"inflates too far", bomb(4096), []error{ErrBadWalls}},
+		{"tiny payload inflates too far", bomb(2048), []error{ErrBadWalls}},
+	}
+
+	for _, c := range cases {
+		_, _, err := Decode(bytes.NewReader(c.data))
+		if err == nil {
+			t.Errorf("%s: expected error", c.name)
+			continue
+		}
+
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expected *DecodeError but got %T: %v", c.name, err, err)
+		}
+		for _, expected := range c.expected {
+			if !errors.Is(err, expected) {
+				t.Errorf("%s: expected %v but got %v", c.name, expected, err)
+			}
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	grid := initGrid(3, 5)
+	mazetest.Generate(f, prims.GetMazeState(), grid)
+
+	meta := NewMeta(grid, 4)
+	meta.Name = "fuzz"
+	for _, compression := range []Compression{CompressionNone, CompressionFlate} {
+		var buf bytes.Buffer
+		if err := EncodeCompressed(&buf, grid, meta, compression); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	var legacy bytes.Buffer
+	for _, v := range []uint16{3, 5, 4} {
+		if err := binary.Write(&legacy, binary.LittleEndian, v); err != nil {
+			f.Fatal(err)
+		}
+	}
+	if err := writeWalls(&legacy, grid); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(legacy.Bytes())
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoded, decodedMeta, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expected *DecodeError but got %T: %v", err, err)
+			}
+			return
+		}
+
+		// anything accepted must survive a round trip unchanged
+		var buf bytes.Buffer
+		if err := Encode(&buf, decoded, decodedMeta); err != nil {
+			t.Fatalf("could not re-encode decoded maze: %v", err)
+		}
+		again, _, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("could not decode re-encoded maze: %v", err)
+		}
+		compareGrids(t, decoded, again)
+	})
+}
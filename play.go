@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/bailey4770/gomazing/leaderboard"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	textv2 "github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	// held keys repeat after repeatDelay ticks, then every repeatInterval ticks
+	repeatDelay    = 15
+	repeatInterval = 4
+
+	confettiCount = 150
+)
+
+const (
+	// ghostAlpha fades the best run's token so it reads as a shadow of the player
+	ghostAlpha = 110
+	// seenAlpha dims tiles the player has seen but cannot see now
+	seenAlpha = 150
+)
+
+type moveKeys struct {
+	keys []ebiten.Key
+	side int
+}
+
+var playMoves = []moveKeys{
+	{[]ebiten.Key{ebiten.KeyArrowUp, ebiten.KeyW}, utils.North},
+	{[]ebiten.Key{ebiten.KeyArrowDown, ebiten.KeyS}, utils.South},
+	{[]ebiten.Key{ebiten.KeyArrowLeft, ebiten.KeyA}, utils.West},
+	{[]ebiten.Key{ebiten.KeyArrowRight, ebiten.KeyD}, utils.East},
+}
+
+// hexPlayMoves puts the diagonals on the keys above and below A and D, since C is taken by the camera
+var hexPlayMoves = []moveKeys{
+	{[]ebiten.Key{ebiten.KeyArrowLeft, ebiten.KeyA}, utils.HexWest},
+	{[]ebiten.Key{ebiten.KeyArrowRight, ebiten.KeyD}, utils.HexEast},
+	{[]ebiten.Key{ebiten.KeyQ}, utils.HexNorthWest},
+	{[]ebiten.Key{ebiten.KeyE}, utils.HexNorthEast},
+	{[]ebiten.Key{ebiten.KeyZ}, utils.HexSouthWest},
+	{[]ebiten.Key{ebiten.KeyX}, utils.HexSouthEast},
+}
+
+// screenMoves head a direction on screen, for polar mazes where the sides turn as the player goes round.
+// The diagonals are on the same keys as in hex mazes.
+var screenMoves = []struct {
+	keys   []ebiten.Key
+	dx, dy float64
+}{
+	{[]ebiten.Key{ebiten.KeyArrowUp, ebiten.KeyW}, 0, -1},
+	{[]ebiten.Key{ebiten.KeyArrowDown, ebiten.KeyS}, 0, 1},
+	{[]ebiten.Key{ebiten.KeyArrowLeft, ebiten.KeyA}, -1, 0},
+	{[]ebiten.Key{ebiten.KeyArrowRight, ebiten.KeyD}, 1, 0},
+	{[]ebiten.Key{ebiten.KeyQ}, -1, -1},
+	{[]ebiten.Key{ebiten.KeyE}, 1, -1},
+	{[]ebiten.Key{ebiten.KeyZ}, -1, 1},
+	{[]ebiten.Key{ebiten.KeyX}, 1, 1},
+}
+
+// maxHeading is how far off the way a key points a polar move may go, as a cosine. It is wide enough that
+// each of a tile's neighbours is reachable from one of the eight keys.
+var maxHeading = math.Cos(67.5 * math.Pi / 180)
+
+// playState is one attempt at walking from the start to the goal. The clock counts ticks
+// from the first move so the time does not depend on frame rate.
+type playState struct {
+	player   *Tile
+	goal     *Tile
+	moves    int
+	ticks    int
+	started  bool
+	won      bool
+	confetti []particle
+	// with fog on only visible tiles are drawn clearly, seen ones are dimmed and the rest hidden
+	fog     bool
+	seen    []bool
+	visible []bool
+	// clearMoves counts moves made with the fog lifted, a run only counts as foggy if there were none
+	clearMoves int
+	// steps is the route so far, saved with the run for ghost replays
+	steps      []leaderboard.Step
+	ghost      *leaderboard.Run
+	showScores bool
+}
+
+type particle struct {
+	x, y, vx, vy float64
+	clr          color.RGBA
+	life         int
+}
+
+func (g *game) startPlay(fog bool) {
+	g.play = &playState{
+		player:  g.grid[g.cfg.Start.Row][g.cfg.Start.Col],
+		goal:    g.grid[g.cfg.Goal.Row][g.cfg.Goal.Col],
+		fog:     fog,
+		seen:    make([]bool, g.grid.Size()),
+		visible: make([]bool, g.grid.Size()),
+	}
+	g.play.look(g.grid, g.cfg.FogRadius)
+	g.play.record()
+	g.cam.follow = true
+
+	if board := g.leaderboard(); board != nil {
+		if best, ok := board.Best(); ok {
+			g.play.ghost = &best
+		}
+	}
+}
+
+func (p *playState) record() {
+	p.steps = append(p.steps, leaderboard.Step{At: p.elapsed(), Row: p.player.Row, Col: p.player.Col})
+}
+
+// look marks what the player can see from where they stand
+func (p *playState) look(grid Grid, radius int) {
+	clear(p.visible)
+	utils.Visible(grid, p.player, radius, func(t *Tile) {
+		i := grid.Index(t)
+		p.visible[i] = true
+		p.seen[i] = true
+	})
+}
+
+func (g *game) updatePlay() error {
+	p := g.play
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.play = nil
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		g.startPlay(p.fog)
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+		p.fog = !p.fog
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		p.showScores = !p.showScores
+	}
+
+	p.updateConfetti()
+	if p.won {
+		return nil
+	}
+
+	if p.started {
+		p.ticks++
+	}
+
+	// shift+arrows belong to the camera
+	if ebiten.IsKeyPressed(ebiten.KeyShift) {
+		return nil
+	}
+
+	if g.grid.Topology().Shape() == utils.ShapePolar {
+		for _, m := range screenMoves {
+			if !anyKeyRepeating(m.keys) {
+				continue
+			}
+			// sides turn as the player goes round, so each move heads from wherever the last one left them
+			if side := g.heading(p.player, m.dx, m.dy); side >= 0 && g.movePlayer(side) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	moves := playMoves
+	if g.grid.Topology() == utils.Hex {
+		moves = hexPlayMoves
+	}
+	for _, m := range moves {
+		if anyKeyRepeating(m.keys) && g.movePlayer(m.side) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// movePlayer steps the player through side if it is open and reports whether that won the run
+func (g *game) movePlayer(side int) bool {
+	p := g.play
+	next := utils.Across(g.grid, p.player, side)
+	if next == nil {
+		return false
+	}
+
+	p.player = next
+	p.moves++
+	p.started = true
+	p.look(g.grid, g.cfg.FogRadius)
+	p.record()
+	if !p.fog {
+		p.clearMoves++
+	}
+
+	if p.player != p.goal {
+		return false
+	}
+
+	p.won = true
+	p.celebrate(g.tileCentre(p.goal))
+	g.finishRun()
+	return true
+}
+
+// heading is the open side of t whose neighbour lies closest to the way (dx, dy) points on screen,
+// or -1 if none are near enough
+func (g *game) heading(t *Tile, dx, dy float64) int {
+	topo := g.grid.Topology()
+	x, y := topo.Centre(t)
+	length := math.Hypot(dx, dy)
+
+	best, bestCos := -1, maxHeading
+	for side := range topo.Sides(t) {
+		next := utils.Across(g.grid, t, side)
+		if next == nil {
+			continue
+		}
+		nx, ny := topo.Centre(next)
+		cos := ((nx-x)*dx + (ny-y)*dy) / (math.Hypot(nx-x, ny-y) * length)
+		if cos > bestCos {
+			best, bestCos = side, cos
+		}
+	}
+	return best
+}
+
+// anyKeyRepeating is true on the tick a key goes down and then at a steady rate while it is held
+func anyKeyRepeating(keys []ebiten.Key) bool {
+	for _, key := range keys {
+		d := inpututil.KeyPressDuration(key)
+		if d == 1 || (d >= repeatDelay && (d-repeatDelay)%repeatInterval == 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *playState) elapsed() time.Duration {
+	return time.Duration(p.ticks) * time.Second / time.Duration(ebiten.TPS())
+}
+
+// celebrate bursts confetti out of (cx, cy), in world pixels
+func (p *playState) celebrate(cx, cy float64) {
+	p.confetti = make([]particle, confettiCount)
+	for i := range p.confetti {
+		p.confetti[i] = particle{
+			x:    cx,
+			y:    cy,
+			vx:   rand.Float64()*8 - 4,
+			vy:   -rand.Float64()*8 - 1,
+			clr:  color.RGBA{uint8(rand.IntN(256)), uint8(rand.IntN(256)), uint8(rand.IntN(256)), 255},
+			life: 60 + rand.IntN(90),
+		}
+	}
+}
+
+func (p *playState) updateConfetti() {
+	alive := p.confetti[:0]
+	for _, c := range p.confetti {
+		c.x += c.vx
+		c.y += c.vy
+		c.vy += 0.2
+		c.life--
+		if c.life > 0 {
+			alive = append(alive, c)
+		}
+	}
+	p.confetti = alive
+}
+
+func (g *game) drawPlay(screen *ebiten.Image) {
+	p := g.play
+	th := g.cfg.Theme
+	inset := float64(g.cfg.WallThickness)
+
+	g.fillTile(screen, g.grid[g.cfg.Start.Row][g.cfg.Start.Col], inset, th.Start)
+	g.fillTile(screen, p.goal, inset, th.Goal)
+
+	if p.fog {
+		rowStart, rowEnd, colStart, colEnd := g.visibleTiles()
+		for _, row := range g.grid[rowStart:rowEnd] {
+			for _, t := range row[colStart:min(colEnd, len(row))] {
+				i := g.grid.Index(t)
+				if p.visible[i] {
+					continue
+				}
+
+				// fog is the background colour so hidden tiles look like empty space
+				clr := th.Background
+				if p.seen[i] {
+					clr.A = seenAlpha
+				}
+				g.fillTile(screen, t, 0, clr)
+			}
+		}
+	}
+
+	if p.ghost != nil && p.started && !p.won {
+		row, col := p.ghost.Position(p.elapsed())
+		ghost := th.Path
+		ghost.A = ghostAlpha
+		g.fillToken(screen, g.grid[row][col], ghost)
+	}
+
+	g.fillToken(screen, p.player, th.Path)
+
+	for _, c := range p.confetti {
+		x, y := g.cam.toScreen(c.x, c.y)
+		vector.FillRect(screen, x, y, float32(3*g.scale), float32(3*g.scale), c.clr, false)
+	}
+}
+
+// drawPlayHUD draws the clock and scores on the UI layer
+func (g *game) drawPlayHUD(ui *ebiten.Image) {
+	p := g.play
+	if p.showScores {
+		g.drawScores(ui)
+	}
+
+	hud := fmt.Sprintf("Time %s  Moves %d", p.elapsed().Truncate(100*time.Millisecond), p.moves)
+	if p.won {
+		hud += "  Solved! R to replay, Esc to exit"
+	} else if p.fog {
+		hud += "  F to lift fog"
+	}
+	if !p.won && g.grid.Topology() != utils.Square {
+		hud += "  Q E Z X diagonals"
+	}
+	if !g.cam.follow {
+		hud += "  C follow"
+	}
+	if !p.showScores {
+		hud += "  T scores"
+	}
+	hudWidth, _ := textv2.Measure(hud, uiFace, 0)
+	x := float32(ui.Bounds().Dx()) - float32(hudWidth) - 16
+	vector.FillRect(ui, x, 0, float32(hudWidth)+16, 22, color.RGBA{0, 0, 0, 200}, false)
+	drawText(ui, hud, int(x)+8, 4, color.White)
+}
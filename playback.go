@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/bailey4770/gomazing/cli"
+	"github.com/bailey4770/gomazing/mazeexport"
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	textv2 "github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	maxStepsPerTick = 1 << 16
+	maxTicksPerStep = 64
+)
+
+// playback controls how fast generation runs. Above one iteration per tick the speed is stepsPerTick,
+// below it is one iteration every ticksPerStep ticks. Only one of the two is ever more than 1.
+type playback struct {
+	paused       bool
+	stepOnce     bool
+	stepsPerTick int
+	ticksPerStep int
+	tick         int
+	iterations   int
+	hideHUD      bool
+}
+
+func newPlayback(speed int) playback {
+	return playback{stepsPerTick: speed, ticksPerStep: 1}
+}
+
+// steps is how many iterations to run this tick
+func (p *playback) steps() int {
+	if p.paused {
+		if p.stepOnce {
+			p.stepOnce = false
+			return 1
+		}
+		return 0
+	}
+
+	if p.ticksPerStep > 1 {
+		p.tick++
+		if p.tick < p.ticksPerStep {
+			return 0
+		}
+		p.tick = 0
+		return 1
+	}
+
+	return p.stepsPerTick
+}
+
+func (p *playback) faster() {
+	if p.ticksPerStep > 1 {
+		p.ticksPerStep /= 2
+		p.tick = 0
+	} else {
+		p.stepsPerTick = min(p.stepsPerTick*2, maxStepsPerTick)
+	}
+}
+
+func (p *playback) slower() {
+	if p.stepsPerTick > 1 {
+		p.stepsPerTick /= 2
+	} else {
+		p.ticksPerStep = min(p.ticksPerStep*2, maxTicksPerStep)
+	}
+}
+
+func (p *playback) speed() string {
+	if p.ticksPerStep > 1 {
+		return fmt.Sprintf("1/%d", p.ticksPerStep)
+	}
+	return fmt.Sprintf("x%d", p.stepsPerTick)
+}
+
+// updateControls handles the playback hotkeys. It returns true if the maze was replaced.
+func (g *game) updateControls() (bool, error) {
+	c := &g.controls
+
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		c.paused = !c.paused
+	case inpututil.IsKeyJustPressed(ebiten.KeyN):
+		c.paused = true
+		c.stepOnce = true
+	case inpututil.IsKeyJustPressed(ebiten.KeyEqual), inpututil.IsKeyJustPressed(ebiten.KeyNumpadAdd):
+		c.faster()
+	case inpututil.IsKeyJustPressed(ebiten.KeyMinus), inpututil.IsKeyJustPressed(ebiten.KeyNumpadSubtract):
+		c.slower()
+	case inpututil.IsKeyJustPressed(ebiten.KeyH):
+		c.hideHUD = !c.hideHUD
+	case inpututil.IsKeyJustPressed(ebiten.KeyV):
+		g.hideInspection = !g.hideInspection
+	case inpututil.IsKeyJustPressed(ebiten.KeyR):
+		return true, g.restart(g.cfg.GeneratorName)
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		return true, g.restart(nextGenerator(g.cfg.GeneratorName))
+	}
+
+	g.updateRewind()
+
+	return false, nil
+}
+
+// nextGenerator cycles through the generators in name order
+func nextGenerator(name string) string {
+	names := slices.Sorted(maps.Keys(cli.GetGenerators()))
+	i := slices.Index(names, name)
+	return names[(i+1)%len(names)]
+}
+
+// restart throws away the maze on screen and starts generating a new one with a fresh seed. Loaded mazes
+// restart with the algorithm that made them, or the first one if that is unknown.
+func (g *game) restart(generatorName string) error {
+	generator, ok := cli.GetGenerators()[generatorName]
+	if !ok {
+		generatorName = nextGenerator("")
+		generator = cli.GetGenerators()[generatorName]
+	}
+
+	seed := time.Now().UnixNano()
+	utils.Seed(seed)
+
+	g.cfg.Generator = generator
+	g.cfg.GeneratorName = generatorName
+	g.cfg.Seed = seed
+	g.cfg.MazePath = ""
+	g.cfg.Start = mazesave.Position{}
+	g.cfg.Goal = mazesave.Position{Row: g.cfg.MaxRows - 1, Col: g.cfg.MaxCols - 1}
+
+	g.setGrid(initGrid(g.cfg))
+	g.generator = generator
+	g.complete = false
+	g.play = nil
+	g.board = nil
+	g.controls.iterations = 0
+	g.history = utils.NewHistory()
+
+	if err := generator.Initialise(g.grid); err != nil {
+		return fmt.Errorf("could not initialise %s: %v", generatorName, err)
+	}
+
+	if g.cfg.RecordPath != "" {
+		recorder, err := mazeexport.NewRecorder(g.cfg.RecordOpts)
+		if err != nil {
+			return err
+		}
+		recorder.Capture(g.grid)
+		g.recorder = recorder
+	}
+
+	g.notify(fmt.Sprintf("New %s maze, seed %d", generatorName, seed))
+	return nil
+}
+
+func (g *game) drawHUD(screen *ebiten.Image) {
+	c := g.controls
+	if c.hideHUD {
+		return
+	}
+
+	state := "running"
+	switch {
+	case g.generator == nil:
+		state = "loaded"
+	case g.history != nil && !g.history.AtHead():
+		state = "rewound"
+	case g.generator.IsComplete():
+		state = "complete"
+	case c.paused:
+		state = "paused"
+	}
+
+	progress := fmt.Sprintf("%d steps", c.iterations)
+	if g.canRewind() {
+		progress = fmt.Sprintf("step %d/%d", g.history.Cursor(), g.history.Len())
+	}
+
+	name := g.cfg.GeneratorName
+	if name == "" {
+		name = "unknown"
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s  seed %d  %s  %s  %s", name, g.cfg.Seed, c.speed(), state, progress),
+		"Space pause  N step  +/- speed  R new  Tab algorithm  V internals  E edit  H hide",
+		"Left/Right undo/redo  Home/End jump  drag the top bar to scrub",
+		"Wheel or PgUp/PgDn zoom  drag or Shift+arrows pan  C fit",
+	}
+	drawHelp(screen, lines)
+}
+
+// drawHelp stacks lines in a panel in the bottom right corner
+func drawHelp(screen *ebiten.Image, lines []string) {
+	bounds := screen.Bounds()
+	var width float64
+	for _, line := range lines {
+		w, _ := textv2.Measure(line, uiFace, 0)
+		width = max(width, w)
+	}
+
+	const lineGap = 16
+	x := float32(bounds.Dx()) - float32(width) - 16
+	y := float32(bounds.Dy()) - float32(len(lines)*lineGap) - 8
+	vector.FillRect(screen, x, y, float32(width)+16, float32(len(lines)*lineGap)+8, color.RGBA{0, 0, 0, 180}, false)
+	for i, line := range lines {
+		drawText(screen, line, int(x)+8, int(y)+4+i*lineGap, color.Gray{200})
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"image/color"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
@@ -10,56 +9,33 @@ import (
 	"golang.org/x/image/font/basicfont"
 )
 
-func drawTileWalls(screen *ebiten.Image, cfg Config, t *Tile) {
-	tileSize := cfg.TileSize
-	wallThickness := cfg.WallThickness
+// uiFace is shared by every overlay that draws text
+var uiFace = textv2.NewGoXFace(basicfont.Face7x13)
 
-	// tile.posX and tile.posY are already pixel coordinates
-	x, y := t.PosX, t.PosY
+// Draw puts the maze and anything attached to it straight on screen in physical pixels, so it stays sharp
+// on HiDPI monitors. Menus and text go on a layer in logical pixels that is scaled up by the device scale.
+func (g *game) Draw(screen *ebiten.Image) {
+	ui := g.uiLayer()
 
-	// NORTH wall
-	if t.WallN {
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Scale(float64(tileSize), float64(wallThickness))
-		op.GeoM.Translate(x, y)
-		screen.DrawImage(cfg.WallImg, op)
+	if g.browser != nil {
+		g.browser.Draw(ui)
+		g.drawUI(screen, ui)
+		return
 	}
 
-	// SOUTH wall
-	if t.WallS {
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Scale(float64(tileSize), float64(wallThickness))
-		op.GeoM.Translate(x, y+float64(tileSize-wallThickness))
-		screen.DrawImage(cfg.WallImg, op)
+	screen.Fill(g.cfg.Theme.Background)
+	if g.cam.zoom == 0 {
+		g.fitCamera()
 	}
+	g.canvas.draw(screen, g.cam, g.visibleTiles)
 
-	// WEST wall
-	if t.WallW {
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Scale(float64(wallThickness), float64(tileSize))
-		op.GeoM.Translate(x, y)
-		screen.DrawImage(cfg.WallImg, op)
-	}
+	g.drawInspection(screen)
 
-	// EAST wall
-	if t.WallE {
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Scale(float64(wallThickness), float64(tileSize))
-		op.GeoM.Translate(x+float64(tileSize-wallThickness), y)
-		screen.DrawImage(cfg.WallImg, op)
+	if g.play != nil {
+		g.drawPlay(screen)
 	}
-}
-
-func (g *game) Draw(screen *ebiten.Image) {
-	for row := 0; row < g.cfg.MaxRows; row++ {
-		for col := 0; col < g.cfg.MaxCols; col++ {
-			tile := g.grid[row][col]
-
-			op := &ebiten.DrawImageOptions{}
-			op.GeoM.Translate(tile.PosX, tile.PosY)
-
-			drawTileWalls(screen, g.cfg, tile)
-		}
+	if g.editor != nil {
+		g.drawEditor(screen)
 	}
 
 	if g.cfg.ShowStats {
@@ -68,32 +44,58 @@ func (g *game) Draw(screen *ebiten.Image) {
 		tps := ebiten.ActualTPS()
 		msg := fmt.Sprintf("FPS: %.2f\nTPS: %.2f",
 			fps, tps)
-		ebitenutil.DebugPrintAt(screen, msg, 1, 1)
+		ebitenutil.DebugPrintAt(ui, msg, 1, 1)
 	}
 
-	if g.isTyping {
-		msg := "Enter maze name: " + string(g.nameBuffer)
-
-		face := textv2.NewGoXFace(basicfont.Face7x13)
-		textWidth, textHeight := textv2.Measure(msg, face, 0)
+	if g.play != nil {
+		g.drawPlayHUD(ui)
+	}
 
-		paddingX, paddingY := 10.0, 10.0
-		rect := ebiten.NewImage(int(textWidth)+int(2*paddingX), int(textHeight)+int(2*paddingY))
-		rect.Fill(color.RGBA{0, 0, 0, 255})
+	if g.dialog != nil {
+		g.dialog.Draw(ui)
+	}
 
-		rectOpts := &ebiten.DrawImageOptions{}
-		rectX, rectY := 20.0, 10.0
-		rectOpts.GeoM.Translate(rectX, rectY)
-		screen.DrawImage(rect, rectOpts)
+	if g.editor != nil && g.dialog == nil {
+		g.drawEditorHUD(ui)
+	} else if g.play == nil && g.dialog == nil {
+		g.drawTimeline(ui)
+		g.drawHUD(ui)
+	}
 
-		var textOpts textv2.DrawOptions
-		textOpts.GeoM.Translate(20, 20)
-		textOpts.ColorScale.ScaleWithColor(color.White)
+	g.drawStatus(ui)
+	g.drawUI(screen, ui)
+}
 
-		textv2.Draw(screen, msg, face, &textOpts)
+// uiLayer returns a cleared image the size of the window in logical pixels
+func (g *game) uiLayer() *ebiten.Image {
+	if g.ui == nil || g.ui.Bounds().Dx() != g.uiW || g.ui.Bounds().Dy() != g.uiH {
+		if g.ui != nil {
+			g.ui.Deallocate()
+		}
+		g.ui = ebiten.NewImage(max(1, g.uiW), max(1, g.uiH))
 	}
+
+	g.ui.Clear()
+	return g.ui
 }
 
+func (g *game) drawUI(screen, ui *ebiten.Image) {
+	op := &ebiten.DrawImageOptions{}
+	// basicfont is a bitmap font, so nearest filtering keeps it crisp at whole number scales
+	op.GeoM.Scale(g.scale, g.scale)
+	screen.DrawImage(ui, op)
+}
+
+// Layout works in physical pixels. It also notices resizes and moves between monitors.
 func (g *game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
-	return outsideWidth, outsideHeight
+	scale := ebiten.Monitor().DeviceScaleFactor()
+	screenWidth = int(float64(outsideWidth) * scale)
+	screenHeight = int(float64(outsideHeight) * scale)
+
+	g.uiW, g.uiH = outsideWidth, outsideHeight
+	if screenWidth != g.screenW || screenHeight != g.screenH || scale != g.scale {
+		g.resize(screenWidth, screenHeight, scale)
+	}
+
+	return screenWidth, screenHeight
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/bailey4770/gomazing/cli"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	timelineHeight = 6
+	// clicks this close to the top of the window land on the timeline
+	timelineGrab = 12
+)
+
+var (
+	timelineBackground = color.RGBA{60, 60, 60, 200}
+	timelineFill       = color.RGBA{90, 150, 230, 230}
+)
+
+// canRewind reports whether the running generator feeds the history log
+func (g *game) canRewind() bool {
+	_, ok := g.generator.(cli.ChangeReporter)
+	return ok && g.history != nil
+}
+
+// recordChanges logs the walls the last Iterate removed
+func (g *game) recordChanges() {
+	if reporter, ok := g.generator.(cli.ChangeReporter); ok && g.history != nil {
+		g.history.Record(g.grid, reporter.Changes())
+	}
+}
+
+// seekToHead brings the grid back to the newest step, so saving or playing never sees a rewound maze
+func (g *game) seekToHead() {
+	if g.history != nil {
+		g.seek(g.history.Len())
+	}
+}
+
+// seek moves the history to step, redrawing whatever changes
+func (g *game) seek(step int) {
+	g.history.Seek(g.grid, step, g.canvas.markEdge)
+}
+
+// updateRewind handles stepping and scrubbing through the history. Any rewind pauses generation,
+// and unpausing replays from the log back to the head before generating anything new.
+func (g *game) updateRewind() {
+	// shift+arrows belong to the camera
+	if !g.canRewind() || ebiten.IsKeyPressed(ebiten.KeyShift) {
+		return
+	}
+	h, c := g.history, &g.controls
+
+	switch {
+	case anyKeyRepeating([]ebiten.Key{ebiten.KeyArrowLeft}):
+		c.paused = true
+		g.seek(h.Cursor() - 1)
+	case anyKeyRepeating([]ebiten.Key{ebiten.KeyArrowRight}):
+		c.paused = true
+		if h.AtHead() {
+			c.stepOnce = true
+		} else {
+			g.seek(h.Cursor() + 1)
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		c.paused = true
+		g.seek(0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnd):
+		g.seekToHead()
+	}
+
+	if h.Len() == 0 || c.hideHUD || !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		return
+	}
+
+	// drags only count if they started on the timeline
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		_, y := g.uiCursor()
+		g.scrubbing = y < timelineGrab
+	}
+	if g.scrubbing {
+		x, _ := g.uiCursor()
+		c.paused = true
+		g.seek(x * h.Len() / max(1, g.uiW))
+	}
+}
+
+func (g *game) drawTimeline(screen *ebiten.Image) {
+	if g.history == nil || g.history.Len() == 0 || g.controls.hideHUD {
+		return
+	}
+
+	width := float32(screen.Bounds().Dx())
+	done := width * float32(g.history.Cursor()) / float32(g.history.Len())
+	vector.FillRect(screen, 0, 0, width, timelineHeight, timelineBackground, false)
+	vector.FillRect(screen, 0, 0, done, timelineHeight, timelineFill, false)
+}
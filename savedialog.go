@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/bailey4770/gomazing/cli"
+	"github.com/bailey4770/gomazing/library"
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	textv2 "github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+type saveField int
+
+const (
+	fieldName saveField = iota
+	fieldDescription
+	fieldTags
+	numSaveFields
+)
+
+var saveFieldLabels = [numSaveFields]string{"Name", "Description", "Tags"}
+
+const (
+	maxNameLength        = 64
+	maxDescriptionLength = 200
+	// how long status messages stay on screen
+	statusSeconds = 3
+)
+
+// saveDialog collects a file name plus optional description and comma separated tags
+type saveDialog struct {
+	fields  [numSaveFields][]rune
+	focus   saveField
+	confirm bool // waiting on y/n to overwrite an existing file
+	err     string
+}
+
+// allowed reports whether r may be typed into field. Names are kept to characters that are safe on every OS.
+func (f saveField) allowed(r rune) bool {
+	switch f {
+	case fieldName:
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" -_.", r)
+	case fieldTags:
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" -_,", r)
+	default:
+		return unicode.IsPrint(r)
+	}
+}
+
+func (f saveField) maxLength() int {
+	if f == fieldDescription {
+		return maxDescriptionLength
+	}
+	return maxNameLength
+}
+
+func (g *game) openSaveDialog() {
+	g.dialog = &saveDialog{}
+}
+
+// notify shows msg at the bottom of the screen for a few seconds
+func (g *game) notify(msg string) {
+	g.status = msg
+	g.statusTicks = statusSeconds * ebiten.TPS()
+}
+
+func (g *game) updateSaveDialog() error {
+	d := g.dialog
+
+	if d.confirm {
+		switch {
+		case inpututil.IsKeyJustPressed(ebiten.KeyY):
+			g.save(true)
+		case inpututil.IsKeyJustPressed(ebiten.KeyN), inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+			d.confirm = false
+		}
+		return nil
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.dialog = nil
+		g.notify("Save cancelled")
+		return nil
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			d.focus = (d.focus + numSaveFields - 1) % numSaveFields
+		} else {
+			d.focus = (d.focus + 1) % numSaveFields
+		}
+		return nil
+	}
+
+	field := &d.fields[d.focus]
+	for _, r := range ebiten.AppendInputChars(nil) {
+		if d.focus.allowed(r) && len(*field) < d.focus.maxLength() {
+			*field = append(*field, r)
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(*field) > 0 {
+		*field = (*field)[:len(*field)-1]
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.save(false)
+	}
+
+	return nil
+}
+
+// save writes the maze under the dialog's name. Problems are shown in the dialog rather than ending the game.
+func (g *game) save(overwrite bool) {
+	d := g.dialog
+	d.confirm = false
+
+	fileName := strings.TrimSpace(string(d.fields[fieldName]))
+	if err := library.ValidateName(fileName); err != nil {
+		d.err = err.Error()
+		d.focus = fieldName
+		return
+	}
+
+	saveDir, err := cli.GetSaveDir()
+	if err != nil {
+		d.err = fmt.Sprintf("could not get save dir: %v", err)
+		return
+	}
+	filePath := filepath.Join(saveDir, fileName)
+
+	if _, err := os.Stat(filePath); err == nil {
+		if !overwrite {
+			d.confirm = true
+			return
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		d.err = fmt.Sprintf("could not check %s: %v", fileName, err)
+		return
+	}
+
+	meta := mazesave.NewMeta(g.grid, g.cfg.TileSize)
+	meta.Algorithm = g.cfg.GeneratorName
+	meta.Seed = g.cfg.Seed
+	meta.Start, meta.Goal = g.cfg.Start, g.cfg.Goal
+	meta.Name = fileName
+	meta.Description = strings.TrimSpace(string(d.fields[fieldDescription]))
+	meta.Tags = parseTags(string(d.fields[fieldTags]))
+
+	if mazesave.IsJSON(filePath) {
+		err = mazesave.SaveMazeJSON(g.grid, meta, filePath)
+	} else if g.cfg.Compress {
+		err = mazesave.SaveMazeCompressed(g.grid, meta, filePath, mazesave.CompressionFlate)
+	} else {
+		err = mazesave.SaveMaze(g.grid, meta, filePath)
+	}
+	if err != nil {
+		d.err = fmt.Sprintf("could not save maze: %v", err)
+		return
+	}
+
+	g.dialog = nil
+	g.notify("Saved " + fileName)
+}
+
+// parseTags splits comma separated tags, dropping blanks and repeats
+func parseTags(s string) []string {
+	var tags []string
+	for tag := range strings.SplitSeq(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (d *saveDialog) Draw(screen *ebiten.Image) {
+	const (
+		x, y    = 20, 10
+		padding = 10
+		lineGap = 20
+		width   = 440
+	)
+
+	lines := make([]string, 0, numSaveFields+2)
+	for i, label := range saveFieldLabels {
+		line := fmt.Sprintf("%-12s %s", label+":", string(d.fields[i]))
+		if saveField(i) == d.focus && !d.confirm {
+			line += "_"
+		}
+		lines = append(lines, line)
+	}
+
+	if d.confirm {
+		lines = append(lines, fmt.Sprintf("%s already exists. Overwrite? (y/n)", strings.TrimSpace(string(d.fields[fieldName]))))
+	} else {
+		lines = append(lines, "Tab next field  Enter save  Esc cancel")
+	}
+
+	height := padding*2 + len(lines)*lineGap
+	if d.err != "" {
+		height += lineGap
+	}
+	vector.FillRect(screen, x, y, width, float32(height), color.RGBA{0, 0, 0, 230}, false)
+
+	for i, line := range lines {
+		clr := color.Color(color.White)
+		if i == len(lines)-1 {
+			clr = color.Gray{160}
+		}
+		drawText(screen, line, x+padding, y+padding+i*lineGap, clr)
+	}
+
+	if d.err != "" {
+		drawText(screen, d.err, x+padding, y+padding+len(lines)*lineGap, color.RGBA{255, 90, 90, 255})
+	}
+}
+
+func (g *game) drawStatus(screen *ebiten.Image) {
+	if g.statusTicks <= 0 {
+		return
+	}
+
+	width, _ := textv2.Measure(g.status, uiFace, 0)
+	height := screen.Bounds().Dy()
+	vector.FillRect(screen, 0, float32(height-24), float32(width+20), 24, color.RGBA{0, 0, 0, 200}, false)
+	drawText(screen, g.status, 10, height-19, color.White)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/bailey4770/gomazing/cli"
+	"github.com/bailey4770/gomazing/leaderboard"
+	"github.com/bailey4770/gomazing/mazesave"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// leaderboard loads the board for the maze on screen the first time it is needed. Problems are shown
+// on screen and play carries on without scores.
+func (g *game) leaderboard() *leaderboard.Board {
+	if g.board != nil {
+		return g.board
+	}
+
+	saveDir, err := cli.GetSaveDir()
+	if err != nil {
+		g.notify(fmt.Sprintf("Could not get save dir: %v", err))
+		return nil
+	}
+
+	hash, err := mazesave.PuzzleHash(g.grid, g.cfg.Start, g.cfg.Goal)
+	if err != nil {
+		g.notify(fmt.Sprintf("Could not hash maze: %v", err))
+		return nil
+	}
+
+	g.board, err = leaderboard.Load(saveDir, hash)
+	if err != nil {
+		g.notify(fmt.Sprintf("Could not load leaderboard: %v", err))
+		return nil
+	}
+	if dropped := g.board.Prune(g.grid); dropped > 0 {
+		g.notify(fmt.Sprintf("Dropped %d leaderboard runs that leave the maze", dropped))
+	}
+
+	return g.board
+}
+
+// finishRun adds the completed run to the leaderboard and reports how it placed
+func (g *game) finishRun() {
+	p := g.play
+	msg := fmt.Sprintf("Solved in %s with %d moves!", p.elapsed().Truncate(10*time.Millisecond), p.moves)
+
+	board := g.leaderboard()
+	if board == nil {
+		g.notify(msg)
+		return
+	}
+
+	place := board.Add(leaderboard.Run{
+		Time:  p.elapsed(),
+		Moves: p.moves,
+		Fog:   p.clearMoves == 0,
+		Date:  time.Now().UTC(),
+		Steps: p.steps,
+	})
+	if place == 0 {
+		g.notify(msg)
+		return
+	}
+
+	if err := board.Save(); err != nil {
+		g.notify(fmt.Sprintf("Could not save leaderboard: %v", err))
+		return
+	}
+
+	if place == 1 {
+		msg += " New best!"
+	} else {
+		msg += fmt.Sprintf(" Number %d on the leaderboard", place)
+	}
+	g.notify(msg)
+}
+
+func (g *game) drawScores(screen *ebiten.Image) {
+	const (
+		x, y    = 20, 30
+		padding = 10
+		lineGap = 18
+		width   = 360
+	)
+
+	lines := []string{"Top scores (T to close)"}
+	if board := g.board; board == nil || len(board.Runs) == 0 {
+		lines = append(lines, "No runs yet")
+	} else {
+		for i, run := range board.Runs {
+			line := fmt.Sprintf("%2d. %-9s %4d moves  %s", i+1, run.Time.Truncate(10*time.Millisecond), run.Moves,
+				run.Date.Local().Format(time.DateOnly))
+			if run.Fog {
+				line += "  fog"
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	vector.FillRect(screen, x, y, width, float32(padding*2+len(lines)*lineGap), color.RGBA{0, 0, 0, 220}, false)
+	for i, line := range lines {
+		drawText(screen, line, x+padding, y+padding+i*lineGap, color.White)
+	}
+}
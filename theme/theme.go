@@ -0,0 +1,200 @@
+// Package theme describes how mazes look: colours for each part of the maze and the wall cap style. Themes are
+// shared by the game renderer and the exporters, and can be built in or loaded from a JSON file.
+package theme
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Caps is how wall ends are drawn
+type Caps int
+
+const (
+	CapsSquare Caps = iota
+	CapsRound
+)
+
+func (c Caps) String() string {
+	if c == CapsRound {
+		return "round"
+	}
+	return "square"
+}
+
+type Theme struct {
+	Name       string
+	Background color.NRGBA
+	Wall       color.NRGBA
+	// Path is the player and solution route
+	Path  color.NRGBA
+	Start color.NRGBA
+	Goal  color.NRGBA
+	// Frontier and Visited colour the generator's working state
+	Frontier color.NRGBA
+	Visited  color.NRGBA
+	Caps     Caps
+}
+
+// Default is the original look: white walls on black
+func Default() Theme {
+	return Theme{
+		Name:       "default",
+		Background: color.NRGBA{0, 0, 0, 255},
+		Wall:       color.NRGBA{255, 255, 255, 255},
+		Path:       color.NRGBA{230, 70, 70, 255},
+		Start:      color.NRGBA{70, 110, 200, 90},
+		Goal:       color.NRGBA{60, 190, 90, 160},
+		Frontier:   color.NRGBA{240, 150, 40, 140},
+		Visited:    color.NRGBA{70, 130, 230, 110},
+		Caps:       CapsSquare,
+	}
+}
+
+func GetThemes() map[string]Theme {
+	return map[string]Theme{
+		"default": Default(),
+		"high-contrast": {
+			Name:       "high-contrast",
+			Background: color.NRGBA{0, 0, 0, 255},
+			Wall:       color.NRGBA{255, 255, 0, 255},
+			Path:       color.NRGBA{0, 255, 255, 255},
+			Start:      color.NRGBA{255, 0, 255, 200},
+			Goal:       color.NRGBA{0, 255, 0, 200},
+			Frontier:   color.NRGBA{255, 128, 0, 200},
+			Visited:    color.NRGBA{255, 255, 255, 120},
+			Caps:       CapsSquare,
+		},
+		"blueprint": {
+			Name:       "blueprint",
+			Background: color.NRGBA{16, 56, 120, 255},
+			Wall:       color.NRGBA{225, 238, 255, 255},
+			Path:       color.NRGBA{255, 210, 90, 255},
+			Start:      color.NRGBA{120, 200, 255, 110},
+			Goal:       color.NRGBA{255, 255, 255, 110},
+			Frontier:   color.NRGBA{255, 255, 255, 70},
+			Visited:    color.NRGBA{90, 150, 230, 120},
+			Caps:       CapsRound,
+		},
+		"paper": {
+			Name:       "paper",
+			Background: color.NRGBA{246, 241, 227, 255},
+			Wall:       color.NRGBA{40, 36, 32, 255},
+			Path:       color.NRGBA{190, 40, 40, 255},
+			Start:      color.NRGBA{80, 120, 190, 90},
+			Goal:       color.NRGBA{70, 150, 80, 110},
+			Frontier:   color.NRGBA{210, 150, 60, 110},
+			Visited:    color.NRGBA{160, 150, 130, 90},
+			Caps:       CapsRound,
+		},
+	}
+}
+
+// themeFile is the JSON form. Colours are "#rrggbb" or "#rrggbbaa" and any left out come from Default.
+type themeFile struct {
+	Name       string `json:"name"`
+	Background string `json:"background"`
+	Wall       string `json:"wall"`
+	Path       string `json:"path"`
+	Start      string `json:"start"`
+	Goal       string `json:"goal"`
+	Frontier   string `json:"frontier"`
+	Visited    string `json:"visited"`
+	Caps       string `json:"caps"`
+}
+
+// Get finds a built-in theme by name, or failing that loads nameOrPath as a theme file
+func Get(nameOrPath string) (Theme, error) {
+	if t, ok := GetThemes()[nameOrPath]; ok {
+		return t, nil
+	}
+
+	t, err := Load(nameOrPath)
+	if err != nil {
+		return Theme{}, fmt.Errorf("%q is not a built-in theme and could not be loaded: %v", nameOrPath, err)
+	}
+	return t, nil
+}
+
+func Load(path string) (Theme, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Theme{}, fmt.Errorf("could not open theme %s: %v", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return Decode(file)
+}
+
+func Decode(r io.Reader) (Theme, error) {
+	var f themeFile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&f); err != nil {
+		return Theme{}, fmt.Errorf("could not decode theme: %v", err)
+	}
+
+	t := Default()
+	t.Name = f.Name
+
+	colours := []struct {
+		key   string
+		value string
+		dst   *color.NRGBA
+	}{
+		{"background", f.Background, &t.Background},
+		{"wall", f.Wall, &t.Wall},
+		{"path", f.Path, &t.Path},
+		{"start", f.Start, &t.Start},
+		{"goal", f.Goal, &t.Goal},
+		{"frontier", f.Frontier, &t.Frontier},
+		{"visited", f.Visited, &t.Visited},
+	}
+	for _, c := range colours {
+		if c.value == "" {
+			continue
+		}
+
+		clr, err := ParseColour(c.value)
+		if err != nil {
+			return Theme{}, fmt.Errorf("bad %s colour: %v", c.key, err)
+		}
+		*c.dst = clr
+	}
+
+	switch f.Caps {
+	case "", "square":
+		t.Caps = CapsSquare
+	case "round":
+		t.Caps = CapsRound
+	default:
+		return Theme{}, fmt.Errorf("caps must be square or round but got %q", f.Caps)
+	}
+
+	return t, nil
+}
+
+// ParseColour reads "#rrggbb" or "#rrggbbaa"
+func ParseColour(s string) (color.NRGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok || (len(hex) != 6 && len(hex) != 8) {
+		return color.NRGBA{}, fmt.Errorf("%q is not #rrggbb or #rrggbbaa", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("%q is not #rrggbb or #rrggbbaa", s)
+	}
+
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
@@ -0,0 +1,55 @@
+package theme
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	th, err := Decode(strings.NewReader(`{"name": "mine", "wall": "#102030", "goal": "#ff000080", "caps": "round"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if th.Name != "mine" || th.Caps != CapsRound {
+		t.Fatalf("expected name and caps from file but got %q and %v", th.Name, th.Caps)
+	}
+	if th.Wall != (color.NRGBA{0x10, 0x20, 0x30, 0xff}) || th.Goal != (color.NRGBA{0xff, 0, 0, 0x80}) {
+		t.Fatalf("expected colours from file but got wall %v and goal %v", th.Wall, th.Goal)
+	}
+	if th.Background != Default().Background {
+		t.Fatalf("expected missing colours to come from the default theme but got %v", th.Background)
+	}
+
+	for _, bad := range []string{
+		`{"wall": "red"}`,
+		`{"wall": "#12345"}`,
+		`{"wall": "#gggggg"}`,
+		`{"caps": "pointy"}`,
+		`{"walls": "#000000"}`,
+		`not json`,
+	} {
+		if _, err := Decode(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error decoding %s", bad)
+		}
+	}
+}
+
+func TestBuiltIns(t *testing.T) {
+	for name, th := range GetThemes() {
+		if th.Name != name {
+			t.Errorf("theme %q calls itself %q", name, th.Name)
+		}
+		if th.Background == th.Wall {
+			t.Errorf("theme %q has walls the same colour as the background", name)
+		}
+	}
+
+	if _, err := Get("paper"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("no-such-theme"); err == nil {
+		t.Fatal("expected an unknown theme name to fail")
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+// Edge is the wall between two adjacent tiles
+type Edge struct {
+	A, B *Tile
+}
+
+// History logs the walls each generator iteration removed so generation can be rewound and replayed without
+// running the generator again. Steps are stored flat as tile index pairs, one int32 offset per step, which
+// keeps the log small enough for mazes with millions of iterations.
+type History struct {
+	edges  [][2]int32
+	ends   []int32
+	cursor int
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+// Record appends one iteration's removed walls. It must only be called at the head of the log.
+func (h *History) Record(grid Grid, removed []Edge) {
+	for _, e := range removed {
+		h.edges = append(h.edges, [2]int32{int32(grid.Index(e.A)), int32(grid.Index(e.B))})
+	}
+	h.ends = append(h.ends, int32(len(h.edges)))
+	h.cursor = len(h.ends)
+}
+
+// Len is the number of recorded steps
+func (h *History) Len() int {
+	return len(h.ends)
+}
+
+// Cursor is how many steps are currently applied to the grid
+func (h *History) Cursor() int {
+	return h.cursor
+}
+
+// AtHead reports whether the grid shows the newest recorded step
+func (h *History) AtHead() bool {
+	return h.cursor == len(h.ends)
+}
+
+// Seek undoes or replays steps until step of them are applied to grid. step is clamped to [0, Len()].
+// changed, if not nil, is called with every wall added or removed on the way.
+func (h *History) Seek(grid Grid, step int, changed func(Edge)) {
+	step = max(0, min(step, len(h.ends)))
+
+	for h.cursor > step {
+		h.cursor--
+		for _, e := range h.edges[h.start(h.cursor):h.ends[h.cursor]] {
+			h.apply(grid, e, true, changed)
+		}
+	}
+
+	for h.cursor < step {
+		for _, e := range h.edges[h.start(h.cursor):h.ends[h.cursor]] {
+			h.apply(grid, e, false, changed)
+		}
+		h.cursor++
+	}
+}
+
+func (h *History) apply(grid Grid, e [2]int32, present bool, changed func(Edge)) {
+	a, b := grid.At(int(e[0])), grid.At(int(e[1]))
+	setWalls(a, b, present)
+	if changed != nil {
+		changed(Edge{A: a, B: b})
+	}
+}
+
+// start is the offset of step's first edge
+func (h *History) start(step int) int32 {
+	if step == 0 {
+		return 0
+	}
+	return h.ends[step-1]
+}
@@ -0,0 +1,51 @@
+package utils_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bailey4770/gomazing/generators/prims"
+	"github.com/bailey4770/gomazing/utils"
+)
+
+func snapshot(grid utils.Grid) []utils.Tile {
+	tiles := make([]utils.Tile, 0, grid.Size())
+	for _, row := range grid {
+		for _, t := range row {
+			tiles = append(tiles, *t)
+		}
+	}
+	return tiles
+}
+
+func TestHistorySeek(t *testing.T) {
+	utils.Seed(42)
+	grid := utils.NewGrid(12, 9)
+	mazeState := prims.GetMazeState()
+	if err := mazeState.Initialise(grid); err != nil {
+		t.Fatal("could not initialise mazestate:", err)
+	}
+
+	history := utils.NewHistory()
+	snapshots := [][]utils.Tile{snapshot(grid)}
+	for !mazeState.IsComplete() {
+		if err := mazeState.Iterate(grid); err != nil {
+			t.Fatal("could not iterate maze state:", err)
+		}
+		history.Record(grid, mazeState.Changes())
+		snapshots = append(snapshots, snapshot(grid))
+	}
+
+	if history.Len() != len(snapshots)-1 || !history.AtHead() {
+		t.Fatalf("expected %d steps at head but got %d at %d", len(snapshots)-1, history.Len(), history.Cursor())
+	}
+
+	for _, step := range []int{0, history.Len() / 2, 1, history.Len(), 3, -5, history.Len() + 5} {
+		history.Seek(grid, step, nil)
+
+		want := snapshots[max(0, min(step, history.Len()))]
+		if got := snapshot(grid); !slices.Equal(got, want) {
+			t.Fatalf("grid after seeking to %d does not match what was generated", step)
+		}
+	}
+}
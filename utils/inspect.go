@@ -0,0 +1,13 @@
+package utils
+
+// Inspection is a generator's working state, exposed so it can be drawn. Generators leave out what they do not have.
+type Inspection struct {
+	// Current is the tile the generator last worked on
+	Current *Tile
+	// Frontier holds tiles next to the maze that have not joined it yet
+	Frontier []*Tile
+	// Stack is the path being backtracked along, oldest first
+	Stack []*Tile
+	// Sets are the disjoint sets of tiles joined so far
+	Sets *UnionFind
+}
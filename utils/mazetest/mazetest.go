@@ -0,0 +1,29 @@
+// Package mazetest holds helpers for tests that need a finished maze to work with
+package mazetest
+
+import (
+	"testing"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+// Generator is the part of a maze generator's state that Generate drives
+type Generator interface {
+	Initialise(utils.Grid) error
+	Iterate(utils.Grid) error
+	IsComplete() bool
+}
+
+// Generate runs gen over grid until the maze is complete, failing tb if any step errors
+func Generate(tb testing.TB, gen Generator, grid utils.Grid) {
+	tb.Helper()
+
+	if err := gen.Initialise(grid); err != nil {
+		tb.Fatal("could not initialise mazestate:", err)
+	}
+	for !gen.IsComplete() {
+		if err := gen.Iterate(grid); err != nil {
+			tb.Fatal("could not iterate maze state:", err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+// MaxRings is the most rings a polar grid can have. Ring lengths are worked out once up to here.
+const MaxRings = 4096
+
+// polar sides. Outward sides come last since there are one or more of them, so the first child is
+// PolarOutward, the second PolarOutward+1 and so on. The centre tile has no inward or around sides,
+// so only its outward ones lead anywhere.
+const (
+	PolarClockwise = iota
+	PolarInward
+	PolarCounterClockwise
+	PolarOutward
+)
+
+// polarRings holds how many tiles are in each ring, and how many tiles come before it for Grid.Index
+var polarRings = newRingTable(MaxRings)
+
+type ringTable struct {
+	counts  []int
+	offsets []int
+}
+
+// newRingTable splits each ring so its tiles stay about one tile wide. Rings are one tile deep, so ring r
+// runs round a circle of radius r and is split again whenever its tiles would be more than about 1.5 wide.
+// The centre is a single tile, then 6, 12, 24, 24, 24, 48 and so on.
+func newRingTable(numRings int) ringTable {
+	// one extra ring so the last real one still knows how its outer side is split
+	counts := make([]int, numRings+1)
+	offsets := make([]int, numRings+2)
+	counts[0] = 1
+	for r := 1; r <= numRings; r++ {
+		width := 2 * math.Pi * float64(r) / float64(counts[r-1])
+		counts[r] = counts[r-1] * max(1, int(math.Round(width)))
+	}
+	for r, count := range counts {
+		offsets[r+1] = offsets[r] + count
+	}
+
+	return ringTable{counts: counts, offsets: offsets}
+}
+
+// outward is how many tiles of the next ring out touch each tile of ring
+func (rt ringTable) outward(ring int) int {
+	return rt.counts[ring+1] / rt.counts[ring]
+}
+
+// polarForward is Forward for the centre and for every other ring, cut down to the tile's outward sides.
+// Only the centre has more than two outward sides, and it has six.
+var polarForward = [2][]int{
+	{PolarOutward, PolarOutward + 1, PolarOutward + 2, PolarOutward + 3, PolarOutward + 4, PolarOutward + 5},
+	{PolarClockwise, PolarOutward, PolarOutward + 1},
+}
+
+// polarTopology lays rings of tiles round a single centre tile, with row the ring counted from the
+// centre and col the place in the ring, going clockwise from east. rings places the centre so the
+// grid starts at 0, 0 like the others.
+type polarTopology struct {
+	rings int
+}
+
+func (polarTopology) Shape() Shape { return ShapePolar }
+func (polarTopology) Name() string { return "polar" }
+
+func (polarTopology) Sides(t *Tile) int {
+	return PolarOutward + polarRings.outward(t.Row)
+}
+
+func (p polarTopology) Neighbour(t *Tile, side int) (int, int) {
+	if side < 0 || side >= p.Sides(t) || (t.Row == 0 && side < PolarOutward) {
+		return -1, -1
+	}
+
+	count := polarRings.counts[t.Row]
+	switch side {
+	case PolarClockwise:
+		return t.Row, (t.Col + 1) % count
+	case PolarCounterClockwise:
+		return t.Row, (t.Col + count - 1) % count
+	case PolarInward:
+		return t.Row - 1, t.Col / polarRings.outward(t.Row-1)
+	default:
+		return t.Row + 1, t.Col*polarRings.outward(t.Row) + side - PolarOutward
+	}
+}
+
+func (p polarTopology) Side(a, b *Tile) int {
+	return sideOf(p, a, b)
+}
+
+// Forward owns the clockwise wall and the ones outward, the centre only having outward ones
+func (polarTopology) Forward(t *Tile) []int {
+	k := polarRings.outward(t.Row)
+	if t.Row == 0 {
+		return polarForward[0][:k]
+	}
+	return polarForward[1][:1+k]
+}
+
+func (polarTopology) Cols(row, _ int) int {
+	return polarRings.counts[row]
+}
+
+// InnerWalls is a wall inward and a wall clockwise for every tile outside the centre
+func (polarTopology) InnerWalls(numRows, _ int) int64 {
+	return 2 * int64(polarRings.offsets[numRows]-1)
+}
+
+// angles is where t starts and ends going clockwise round its ring
+func (polarTopology) angles(t *Tile) (float64, float64) {
+	step := 2 * math.Pi / float64(polarRings.counts[t.Row])
+	return float64(t.Col) * step, float64(t.Col+1) * step
+}
+
+func (p polarTopology) at(radius, angle float64) (float64, float64) {
+	r := float64(p.rings)
+	return r + radius*math.Cos(angle), r + radius*math.Sin(angle)
+}
+
+func (p polarTopology) Centre(t *Tile) (float64, float64) {
+	if t.Row == 0 {
+		return p.at(0, 0)
+	}
+	start, end := p.angles(t)
+	return p.at(float64(t.Row)+0.5, (start+end)/2)
+}
+
+// Corner 0 is the outer clockwise corner, then the inner clockwise and counter clockwise ones, then round
+// the outside. The centre has no inner corners, so its first four are all on the outside at angle 0
+// and its inward and around sides have no length.
+func (p polarTopology) Corner(t *Tile, i int) (float64, float64) {
+	sides := p.Sides(t)
+	i %= sides
+	start, end := p.angles(t)
+	inner, outer := float64(t.Row), float64(t.Row+1)
+
+	switch {
+	case t.Row == 0 && i <= PolarOutward:
+		return p.at(outer, 0)
+	case i == 0:
+		return p.at(outer, end)
+	case i == 1:
+		return p.at(inner, end)
+	case i == 2:
+		return p.at(inner, start)
+	default:
+		k := sides - PolarOutward
+		return p.at(outer, start+(end-start)*float64(i-PolarOutward)/float64(k))
+	}
+}
+
+// Arc bends the inward and outward sides round the centre of the grid
+func (p polarTopology) Arc(t *Tile, side int) (float64, float64, float64, bool) {
+	cx, cy := p.at(0, 0)
+	switch {
+	case side >= PolarOutward:
+		return cx, cy, float64(t.Row + 1), true
+	case side == PolarInward && t.Row > 0:
+		return cx, cy, float64(t.Row), true
+	default:
+		return 0, 0, 0, false
+	}
+}
+
+// Size is a circle with a radius of one tile per ring
+func (polarTopology) Size(numRows, _ int) (float64, float64) {
+	return 2 * float64(numRows), 2 * float64(numRows)
+}
+
+// Locate is exact for polar grids
+func (p polarTopology) Locate(x, y float64) (int, int) {
+	cx, cy := p.at(0, 0)
+	dx, dy := x-cx, y-cy
+	row := int(math.Floor(math.Hypot(dx, dy)))
+	if row >= MaxRings {
+		return row, 0
+	}
+
+	angle := math.Atan2(dy, dx)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	count := polarRings.counts[row]
+	return row, min(count-1, int(angle/(2*math.Pi)*float64(count)))
+}
+
+// polarAt is the inverse of polarIndex
+func polarAt(i int) (int, int) {
+	row := sort.SearchInts(polarRings.offsets, i+1) - 1
+	return row, i - polarRings.offsets[row]
+}
+
+func polarIndex(t *Tile) int {
+	return polarRings.offsets[t.Row] + t.Col
+}
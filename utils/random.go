@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// rng is shared by every generator so that a single seed reproduces a whole maze
+var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Seed resets the shared random source. Call before Initialise for reproducible mazes.
+func Seed(seed int64) {
+	rng = rand.New(rand.NewSource(seed))
+}
+
+func RandIntn(n int) int {
+	return rng.Intn(n)
+}
+
+func Shuffle(n int, swap func(i, j int)) {
+	rng.Shuffle(n, swap)
+}
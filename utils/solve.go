@@ -0,0 +1,45 @@
+package utils
+
+// Solve returns the shortest route from one tile to another through open walls, both ends included.
+// It is nil when walls cut the two off from each other.
+func Solve(grid Grid, from, to *Tile) []*Tile {
+	// prev holds the index of the tile each one was reached from, -1 while unreached
+	prev := make([]int32, grid.Size())
+	for i := range prev {
+		prev[i] = -1
+	}
+
+	start := grid.Index(from)
+	prev[start] = int32(start)
+	queue := []*Tile{from}
+	for len(queue) > 0 && prev[grid.Index(to)] < 0 {
+		t := queue[0]
+		queue = queue[1:]
+
+		for side := range t.Topology().Sides(t) {
+			next := Across(grid, t, side)
+			if next == nil || prev[grid.Index(next)] >= 0 {
+				continue
+			}
+			prev[grid.Index(next)] = int32(grid.Index(t))
+			queue = append(queue, next)
+		}
+	}
+
+	if prev[grid.Index(to)] < 0 {
+		return nil
+	}
+
+	var route []*Tile
+	for i := grid.Index(to); ; i = int(prev[i]) {
+		route = append(route, grid.At(i))
+		if i == start {
+			break
+		}
+	}
+	for i, j := 0, len(route)-1; i < j; i, j = i+1, j-1 {
+		route[i], route[j] = route[j], route[i]
+	}
+
+	return route
+}
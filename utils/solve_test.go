@@ -0,0 +1,36 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+func TestSolve(t *testing.T) {
+	grid := utils.NewGrid(2, 3)
+	if route := utils.Solve(grid, grid[0][0], grid[1][2]); route != nil {
+		t.Fatalf("expected no route through a grid of walls but got %d tiles", len(route))
+	}
+
+	// one winding passage, so there is only one route to find
+	utils.RemoveWalls(grid[0][0], grid[1][0])
+	utils.RemoveWalls(grid[1][0], grid[1][1])
+	utils.RemoveWalls(grid[1][1], grid[0][1])
+	utils.RemoveWalls(grid[0][1], grid[0][2])
+	utils.RemoveWalls(grid[0][2], grid[1][2])
+
+	expected := []*utils.Tile{grid[0][0], grid[1][0], grid[1][1], grid[0][1], grid[0][2], grid[1][2]}
+	route := utils.Solve(grid, grid[0][0], grid[1][2])
+	if len(route) != len(expected) {
+		t.Fatalf("expected a %d tile route from (0,0) to (1,2) but got %d tiles", len(expected), len(route))
+	}
+	for i, tile := range route {
+		if tile != expected[i] {
+			t.Fatalf("expected step %d at (%d,%d) but got (%d,%d)", i, expected[i].Row, expected[i].Col, tile.Row, tile.Col)
+		}
+	}
+
+	if route := utils.Solve(grid, grid[1][1], grid[1][1]); len(route) != 1 {
+		t.Fatalf("expected a route to the same tile to be just that tile but got %d tiles", len(route))
+	}
+}
@@ -0,0 +1,325 @@
+package utils
+
+import "math"
+
+// Shape names a topology. Every tile in a grid has the same one, so it is kept in the tiles.
+type Shape uint8
+
+const (
+	ShapeSquare Shape = iota
+	ShapeHex
+	ShapePolar
+)
+
+// Topology is how tiles fit together: which tiles touch across each side and where tiles sit in the plane.
+// Generators only ever ask for neighbours, so they work on any topology.
+//
+// Geometry is in tile widths with y pointing down. Sides are numbered clockwise, and side i of a tile runs
+// from Corner i to Corner i+1.
+type Topology interface {
+	Shape() Shape
+	Name() string
+	// Sides is how many walls t has. Polar tiles have more on the outside as rings get longer.
+	Sides(t *Tile) int
+	// Neighbour is where the tile across side of t would be. It may be off the grid.
+	Neighbour(t *Tile, side int) (row, col int)
+	// Side is the side of a facing b, or -1 when they do not touch
+	Side(a, b *Tile) int
+	// Forward lists the sides t owns, so each wall between two tiles belongs to exactly one of them
+	Forward(t *Tile) []int
+	// Cols is how many tiles are in row of a grid numCols wide. Only polar rows differ in length.
+	Cols(row, numCols int) int
+	// InnerWalls is how many walls lie between two tiles, rather than on the edge, in a whole grid
+	InnerWalls(numRows, numCols int) int64
+
+	Centre(t *Tile) (x, y float64)
+	Corner(t *Tile, i int) (x, y float64)
+	// Size is the width and height of a whole grid
+	Size(numRows, numCols int) (width, height float64)
+	// Locate is roughly the row and col at (x, y). It may be off by one either way, see TileAt.
+	Locate(x, y float64) (row, col int)
+}
+
+// Curved is a Topology with some sides bent into arcs. Corner still gives the ends of every side.
+type Curved interface {
+	Topology
+	// Arc is the centre and radius of the circle side follows, ok is false for straight sides
+	Arc(t *Tile, side int) (cx, cy, radius float64, ok bool)
+}
+
+// square sides
+const (
+	North = iota
+	East
+	South
+	West
+)
+
+// hex sides. Hex grids are pointy topped with odd rows pushed half a tile right.
+const (
+	HexEast = iota
+	HexSouthEast
+	HexSouthWest
+	HexWest
+	HexNorthWest
+	HexNorthEast
+)
+
+var (
+	Square Topology = squareTopology{}
+	Hex    Topology = hexTopology{}
+	// Polar only knows how tiles connect. Use Grid.Topology for positions, which depend on the number of rings.
+	Polar Topology = polarTopology{}
+)
+
+func GetTopologies() map[string]Topology {
+	return map[string]Topology{
+		Square.Name(): Square,
+		Hex.Name():    Hex,
+		Polar.Name():  Polar,
+	}
+}
+
+// TopologyOf is the topology for shape, square if it is unknown
+func TopologyOf(shape Shape) Topology {
+	switch shape {
+	case ShapeHex:
+		return Hex
+	case ShapePolar:
+		return Polar
+	default:
+		return Square
+	}
+}
+
+func allWalls(sides int) uint16 {
+	return 1<<sides - 1
+}
+
+// sideOf finds the side of a that b is across
+func sideOf(topo Topology, a, b *Tile) int {
+	for side := range topo.Sides(a) {
+		if row, col := topo.Neighbour(a, side); row == b.Row && col == b.Col {
+			return side
+		}
+	}
+	return -1
+}
+
+// TileAt is the tile whose outline contains (x, y), in tile widths, or nil if there is none
+func TileAt(grid Grid, x, y float64) *Tile {
+	if grid.Size() == 0 {
+		return nil
+	}
+	topo := grid.Topology()
+	guessRow, guessCol := topo.Locate(x, y)
+
+	// curved sides are not straight between their corners, but Locate is exact for them
+	if _, ok := topo.(Curved); ok {
+		if guessRow < 0 || guessRow >= len(grid) || guessCol < 0 || guessCol >= len(grid[guessRow]) {
+			return nil
+		}
+		return grid[guessRow][guessCol]
+	}
+
+	for row := guessRow - 1; row <= guessRow+1; row++ {
+		for col := guessCol - 1; col <= guessCol+1; col++ {
+			if row < 0 || row >= len(grid) || col < 0 || col >= len(grid[row]) {
+				continue
+			}
+			if t := grid[row][col]; contains(topo, t, x, y) {
+				return t
+			}
+		}
+	}
+
+	return nil
+}
+
+// contains tests (x, y) against each side of t's convex outline
+func contains(topo Topology, t *Tile, x, y float64) bool {
+	sides := topo.Sides(t)
+	for i := range sides {
+		x0, y0 := topo.Corner(t, i)
+		x1, y1 := topo.Corner(t, (i+1)%sides)
+		// corners go clockwise on screen, so inside is to the right of every side
+		if (x1-x0)*(y-y0)-(y1-y0)*(x-x0) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type squareTopology struct{}
+
+func (squareTopology) Shape() Shape    { return ShapeSquare }
+func (squareTopology) Name() string    { return "square" }
+func (squareTopology) Sides(*Tile) int { return 4 }
+
+func (squareTopology) Neighbour(t *Tile, side int) (int, int) {
+	switch side {
+	case North:
+		return t.Row - 1, t.Col
+	case East:
+		return t.Row, t.Col + 1
+	case South:
+		return t.Row + 1, t.Col
+	default:
+		return t.Row, t.Col - 1
+	}
+}
+
+func (s squareTopology) Side(a, b *Tile) int {
+	return sideOf(s, a, b)
+}
+
+// squareForward is east then south, the order the save format has always used
+var squareForward = []int{East, South}
+
+func (squareTopology) Forward(*Tile) []int {
+	return squareForward
+}
+
+func (squareTopology) Cols(_, numCols int) int {
+	return numCols
+}
+
+func (squareTopology) InnerWalls(numRows, numCols int) int64 {
+	return int64(numRows)*int64(numCols-1) + int64(numRows-1)*int64(numCols)
+}
+
+func (squareTopology) Centre(t *Tile) (float64, float64) {
+	return float64(t.Col) + 0.5, float64(t.Row) + 0.5
+}
+
+func (squareTopology) Corner(t *Tile, i int) (float64, float64) {
+	x, y := float64(t.Col), float64(t.Row)
+	switch i % 4 {
+	case 0:
+		return x, y
+	case 1:
+		return x + 1, y
+	case 2:
+		return x + 1, y + 1
+	default:
+		return x, y + 1
+	}
+}
+
+func (squareTopology) Size(numRows, numCols int) (float64, float64) {
+	return float64(numCols), float64(numRows)
+}
+
+func (squareTopology) Locate(x, y float64) (int, int) {
+	return int(math.Floor(y)), int(math.Floor(x))
+}
+
+type hexTopology struct{}
+
+// hexRadius is the distance from a hex's centre to its corners when it is one tile wide across the flats
+var hexRadius = 1 / math.Sqrt(3)
+
+func (hexTopology) Shape() Shape    { return ShapeHex }
+func (hexTopology) Name() string    { return "hex" }
+func (hexTopology) Sides(*Tile) int { return 6 }
+
+func (hexTopology) Neighbour(t *Tile, side int) (int, int) {
+	// odd rows sit half a tile right, so the tiles above and below are shifted along by one
+	shift := t.Row & 1
+	switch side {
+	case HexEast:
+		return t.Row, t.Col + 1
+	case HexSouthEast:
+		return t.Row + 1, t.Col + shift
+	case HexSouthWest:
+		return t.Row + 1, t.Col + shift - 1
+	case HexWest:
+		return t.Row, t.Col - 1
+	case HexNorthWest:
+		return t.Row - 1, t.Col + shift - 1
+	default:
+		return t.Row - 1, t.Col + shift
+	}
+}
+
+func (h hexTopology) Side(a, b *Tile) int {
+	return sideOf(h, a, b)
+}
+
+var hexForward = []int{HexEast, HexSouthEast, HexSouthWest}
+
+func (hexTopology) Forward(*Tile) []int {
+	return hexForward
+}
+
+func (hexTopology) Cols(_, numCols int) int {
+	return numCols
+}
+
+// InnerWalls counts the east walls, then between each pair of rows one wall per tile going down
+// one way and one less going down the other
+func (hexTopology) InnerWalls(numRows, numCols int) int64 {
+	return int64(numRows)*int64(numCols-1) + int64(numRows-1)*int64(2*numCols-1)
+}
+
+func (hexTopology) Centre(t *Tile) (float64, float64) {
+	return float64(t.Col) + 0.5 + 0.5*float64(t.Row&1), hexRadius + 1.5*hexRadius*float64(t.Row)
+}
+
+// Corner 0 is the top of the east side, then they go clockwise in steps of 60 degrees
+func (h hexTopology) Corner(t *Tile, i int) (float64, float64) {
+	cx, cy := h.Centre(t)
+	angle := math.Pi / 180 * float64(60*(i%6)-30)
+	return cx + hexRadius*math.Cos(angle), cy + hexRadius*math.Sin(angle)
+}
+
+func (hexTopology) Size(numRows, numCols int) (float64, float64) {
+	width := float64(numCols)
+	if numRows > 1 {
+		width += 0.5
+	}
+	return width, 2*hexRadius + 1.5*hexRadius*float64(max(0, numRows-1))
+}
+
+func (hexTopology) Locate(x, y float64) (int, int) {
+	row := int(math.Floor(y / (1.5 * hexRadius)))
+	return row, int(math.Floor(x - 0.5*float64(row&1)))
+}
+
+// SidePoints runs along side of t from Corner side to Corner side+1. Curved sides get extra points no
+// more than step apart so they can be drawn as straight pieces.
+func SidePoints(topo Topology, t *Tile, side int, step float64) [][2]float64 {
+	x1, y1 := topo.Corner(t, side)
+	x2, y2 := topo.Corner(t, side+1)
+
+	if curved, ok := topo.(Curved); ok {
+		if cx, cy, _, ok := curved.Arc(t, side); ok {
+			return ArcPoints(cx, cy, x1, y1, x2, y2, step)
+		}
+	}
+	return [][2]float64{{x1, y1}, {x2, y2}}
+}
+
+// ArcPoints runs the short way round the circle centred on (cx, cy) from (x1, y1) to (x2, y2), which must be
+// the same distance from the centre, with points no more than step apart
+func ArcPoints(cx, cy, x1, y1, x2, y2, step float64) [][2]float64 {
+	radius := math.Hypot(x1-cx, y1-cy)
+	start := math.Atan2(y1-cy, x1-cx)
+	sweep := math.Atan2(y2-cy, x2-cx) - start
+	// take the short way round
+	if sweep > math.Pi {
+		sweep -= 2 * math.Pi
+	} else if sweep < -math.Pi {
+		sweep += 2 * math.Pi
+	}
+
+	n := max(1, int(math.Ceil(math.Abs(sweep)*radius/step)))
+	points := make([][2]float64, 0, n+1)
+	points = append(points, [2]float64{x1, y1})
+	for i := 1; i < n; i++ {
+		angle := start + sweep*float64(i)/float64(n)
+		points = append(points, [2]float64{cx + radius*math.Cos(angle), cy + radius*math.Sin(angle)})
+	}
+	// finish exactly on the corner so neighbouring tiles meet without gaps
+	return append(points, [2]float64{x2, y2})
+}
@@ -0,0 +1,72 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/bailey4770/gomazing/generators/dfs"
+	"github.com/bailey4770/gomazing/generators/kruskals"
+	"github.com/bailey4770/gomazing/generators/prims"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/bailey4770/gomazing/utils/mazetest"
+)
+
+func TestTopologies(t *testing.T) {
+	for name, topo := range utils.GetTopologies() {
+		grid := utils.NewGridOf(topo, 5, 6)
+		if grid.Topology().Shape() != topo.Shape() {
+			t.Fatalf("%s grid reports itself as %s", name, grid.Topology().Name())
+		}
+		// polar geometry depends on how many rings there are, so it comes from the grid
+		topo = grid.Topology()
+
+		for _, row := range grid {
+			for _, tile := range row {
+				// every neighbour must see tile back across one of its own sides
+				if got := grid.At(grid.Index(tile)); got != tile {
+					t.Fatalf("%s: index of (%d, %d) leads to %v", name, tile.Row, tile.Col, got)
+				}
+
+				for _, n := range utils.FindNeighbours(tile, grid, len(grid), grid.Cols()) {
+					side := topo.Side(n, tile)
+					if side < 0 {
+						t.Fatalf("%s: (%d, %d) touches (%d, %d) but not the other way round", name, tile.Row, tile.Col, n.Row, n.Col)
+					}
+					if r, c := topo.Neighbour(n, side); r != tile.Row || c != tile.Col {
+						t.Fatalf("%s: side %d of (%d, %d) does not lead back to (%d, %d)", name, side, n.Row, n.Col, tile.Row, tile.Col)
+					}
+				}
+
+				x, y := topo.Centre(tile)
+				if got := utils.TileAt(grid, x, y); got != tile {
+					t.Fatalf("%s: centre of (%d, %d) located in %v", name, tile.Row, tile.Col, got)
+				}
+			}
+		}
+
+		width, height := topo.Size(len(grid), grid.Cols())
+		if utils.TileAt(grid, -0.1, -0.1) != nil || utils.TileAt(grid, width+0.1, height+0.1) != nil {
+			t.Fatalf("%s: found a tile outside the grid", name)
+		}
+	}
+}
+
+func TestGenerateTopologies(t *testing.T) {
+	utils.Seed(3)
+	for _, topo := range []utils.Topology{utils.Hex, utils.Polar} {
+		// generators only run once, so each topology gets new ones
+		generators := map[string]mazetest.Generator{
+			"dfs":      dfs.GetMazeState(),
+			"prims":    prims.GetMazeState(),
+			"kruskals": kruskals.GetMazeState(),
+		}
+
+		for name, gen := range generators {
+			grid := utils.NewGridOf(topo, 7, 8)
+			mazetest.Generate(t, gen, grid)
+
+			if v := utils.Validate(grid); !v.Perfect() {
+				t.Fatalf("%s: expected a perfect %s maze but got %+v", name, topo.Name(), v)
+			}
+		}
+	}
+}
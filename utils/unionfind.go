@@ -1,35 +1,41 @@
 package utils
 
-import "fmt"
-
+// UnionFind tracks disjoint sets of tiles. Sets live in slices indexed by Grid.Index so it scales to huge grids.
 type UnionFind struct {
-	parent map[*Tile]*Tile
-	rank   map[*Tile]int
+	grid   Grid
+	parent []int32
+	rank   []uint8
 }
 
-func NewUnionFind() *UnionFind {
+func NewUnionFind(grid Grid) *UnionFind {
+	parent := make([]int32, grid.Size())
+	for i := range parent {
+		parent[i] = int32(i)
+	}
+
 	return &UnionFind{
-		parent: make(map[*Tile]*Tile),
-		rank:   make(map[*Tile]int),
+		grid:   grid,
+		parent: parent,
+		rank:   make([]uint8, grid.Size()),
 	}
 }
 
 func (uf *UnionFind) Find(tile *Tile) *Tile {
-	if _, ok := uf.parent[tile]; !ok {
-		uf.parent[tile] = tile
-		return tile
-	}
+	return uf.grid.At(int(uf.find(int32(uf.grid.Index(tile)))))
+}
 
-	if uf.parent[tile] != tile {
-		uf.parent[tile] = uf.Find(uf.parent[tile])
+func (uf *UnionFind) find(i int32) int32 {
+	// iterative with path halving, recursion would blow the stack on huge grids
+	for uf.parent[i] != i {
+		uf.parent[i] = uf.parent[uf.parent[i]]
+		i = uf.parent[i]
 	}
-
-	return uf.parent[tile]
+	return i
 }
 
 func (uf *UnionFind) Union(tile1, tile2 *Tile) {
-	root1 := uf.Find(tile1)
-	root2 := uf.Find(tile2)
+	root1 := uf.find(int32(uf.grid.Index(tile1)))
+	root2 := uf.find(int32(uf.grid.Index(tile2)))
 
 	if root1 == root2 {
 		return
@@ -46,10 +52,22 @@ func (uf *UnionFind) Union(tile1, tile2 *Tile) {
 }
 
 func (uf *UnionFind) AreConnected(tile1, tile2 *Tile) bool {
-	return uf.Find(tile1) == uf.Find(tile2)
+	return uf.find(int32(uf.grid.Index(tile1))) == uf.find(int32(uf.grid.Index(tile2)))
+}
+
+// SetID names the set tile is in and reports whether that set has other tiles in it.
+// A root only ever gains children when its rank is at least 1, so rank 0 roots are alone.
+func (uf *UnionFind) SetID(tile *Tile) (int, bool) {
+	root := uf.find(int32(uf.grid.Index(tile)))
+	return int(root), uf.rank[root] > 0
 }
 
 func (uf *UnionFind) CountSets() int {
-	fmt.Printf("number of sets: %d", len(uf.parent))
-	return len(uf.parent)
+	count := 0
+	for i := range uf.parent {
+		if uf.parent[i] == int32(i) {
+			count++
+		}
+	}
+	return count
 }
@@ -1,46 +1,132 @@
 // Package utils defines Tile type. Recommend to define Tile alias. Package contains tile utility functions
 package utils
 
-import (
-	"errors"
-	"math/rand"
-)
+import "errors"
 
+// Tile holds only its place in the grid and its walls. Pixel positions depend on the current layout
+// and are worked out when drawing.
 type Tile struct {
-	PosX  float64
-	PosY  float64
-	Row   int
-	Col   int
-	WallN bool
-	WallE bool
-	WallS bool
-	WallW bool
+	Row int
+	Col int
+	// Walls has bit i set while side i is walled. Which side is which depends on Shape.
+	Walls uint16
+	Shape Shape
+}
+
+func CreateTile(row, col int) *Tile {
+	return &Tile{Row: row, Col: col, Walls: allWalls(4), Shape: ShapeSquare}
+}
+
+func (t *Tile) Wall(side int) bool {
+	return t.Walls&(1<<side) != 0
 }
 
-func CreateTile(posX, posY float64, row, col int) *Tile {
-	return &Tile{
-		PosX:  posX,
-		PosY:  posY,
-		Row:   row,
-		Col:   col,
-		WallN: true,
-		WallE: true,
-		WallS: true,
-		WallW: true,
+func (t *Tile) SetWall(side int, present bool) {
+	if present {
+		t.Walls |= 1 << side
+	} else {
+		t.Walls &^= 1 << side
 	}
 }
 
+// Topology is how t connects to its neighbours. Polar positions also depend on the size of the grid,
+// so draw with Grid.Topology instead.
+func (t *Tile) Topology() Topology {
+	return TopologyOf(t.Shape)
+}
+
 type (
 	Grid [][]*Tile
 )
 
-func (grid Grid) ResetGrid() {
+// NewGrid allocates a grid of fully walled square tiles
+func NewGrid(numRows, numCols int) Grid {
+	return NewGridOf(Square, numRows, numCols)
+}
+
+// NewGridOf allocates a grid of fully walled tiles laid out by topo. Polar grids have numRows rings and
+// numCols is ignored, since each ring is as long as it needs to be.
+// Tiles share one backing array so huge grids are a single allocation rather than one per tile.
+func NewGridOf(topo Topology, numRows, numCols int) Grid {
+	size := 0
+	for row := range numRows {
+		size += topo.Cols(row, numCols)
+	}
+
+	grid := make(Grid, numRows)
+	tiles := make([]Tile, size)
+	pointers := make([]*Tile, size)
+	shape := topo.Shape()
+
+	start := 0
 	for row := range grid {
+		end := start + topo.Cols(row, numCols)
+		grid[row] = pointers[start:end:end]
+
 		for col := range grid[row] {
-			grid[row][col].WallN = true
-			grid[row][col].WallE = true
-			grid[row][col].WallS = true
-			grid[row][col].WallW = true
+			tile := &tiles[start+col]
+			*tile = Tile{Row: row, Col: col, Shape: shape}
+			tile.Walls = allWalls(topo.Sides(tile))
+			grid[row][col] = tile
+		}
+		start = end
+	}
+
+	return grid
+}
+
+// Topology is how the grid's tiles fit together. Grids with no tiles count as square.
+func (grid Grid) Topology() Topology {
+	if grid.Size() == 0 {
+		return Square
+	}
+	if grid[0][0].Shape == ShapePolar {
+		return polarTopology{rings: len(grid)}
+	}
+	return grid[0][0].Topology()
+}
+
+// Cols is the length of the longest row. Polar rows get longer going out, the rest are all the same.
+func (grid Grid) Cols() int {
+	if len(grid) == 0 {
+		return 0
+	}
+	return len(grid[len(grid)-1])
+}
+
+// Index gives each tile a unique number in [0, Size()) so generators can use slices instead of maps
+func (grid Grid) Index(t *Tile) int {
+	if t.Shape == ShapePolar {
+		return polarIndex(t)
+	}
+	return t.Row*len(grid[0]) + t.Col
+}
+
+// At is the inverse of Index
+func (grid Grid) At(i int) *Tile {
+	if grid[0][0].Shape == ShapePolar {
+		row, col := polarAt(i)
+		return grid[row][col]
+	}
+
+	numCols := len(grid[0])
+	return grid[i/numCols][i%numCols]
+}
+
+func (grid Grid) Size() int {
+	if len(grid) == 0 {
+		return 0
+	}
+	if grid[0][0].Shape == ShapePolar {
+		return polarRings.offsets[len(grid)]
+	}
+	return len(grid) * len(grid[0])
+}
+
+func (grid Grid) ResetGrid() {
+	for row := range grid {
+		for _, tile := range grid[row] {
+			tile.Walls = allWalls(tile.Topology().Sides(tile))
 		}
 	}
 }
@@ -51,25 +137,18 @@ func GetRandomTile(tiles []*Tile) (*Tile, int, error) {
 	}
 
 	// choose random tile from frontier list
-	randomIndex := rand.Intn(len(tiles))
+	randomIndex := RandIntn(len(tiles))
 	return tiles[randomIndex], randomIndex, nil
 }
 
+// FindNeighbours lists the tiles touching t, walls or not
 func FindNeighbours(t *Tile, grid Grid, maxRows, maxCols int) []*Tile {
-	dirs := [4]struct{ rowOffset, colOffset int }{
-		{-1, 0},
-		{0, 1},
-		{1, 0},
-		{0, -1},
-	}
+	topo := t.Topology()
+	neighbours := make([]*Tile, 0, topo.Sides(t))
 
-	neighbours := make([]*Tile, 0, 4)
-
-	for _, dir := range dirs {
-		newRow := t.Row + dir.rowOffset
-		newCol := t.Col + dir.colOffset
-
-		if (newRow >= 0 && newRow < maxRows) && (newCol >= 0 && newCol < maxCols) {
+	for side := range topo.Sides(t) {
+		newRow, newCol := topo.Neighbour(t, side)
+		if (newRow >= 0 && newRow < maxRows) && (newCol >= 0 && newCol < min(maxCols, len(grid[newRow]))) {
 			neighbours = append(neighbours, grid[newRow][newCol])
 		}
 	}
@@ -78,30 +157,50 @@ func FindNeighbours(t *Tile, grid Grid, maxRows, maxCols int) []*Tile {
 }
 
 func RemoveWalls(tile1 *Tile, tile2 *Tile) {
-	type wallPair struct {
-		frontierWall *bool
-		visitedWall  *bool
-	}
-	var walls wallPair
-
-	if tile2.Col == tile1.Col {
-		if tile1.Row < tile2.Row {
-			// visited is to the south
-			walls = wallPair{&tile1.WallS, &tile2.WallN}
-		} else if tile2.Row < tile1.Row {
-			// visited to the north
-			walls = wallPair{&tile1.WallN, &tile2.WallS}
-		}
-	} else if tile2.Row == tile1.Row {
-		if tile1.Col < tile2.Col {
-			// visited to west
-			walls = wallPair{&tile1.WallE, &tile2.WallW}
-		} else if tile2.Col < tile1.Col {
-			// visited to east
-			walls = wallPair{&tile1.WallW, &tile2.WallE}
+	setWalls(tile1, tile2, false)
+}
+
+// AddWalls puts back the wall between two adjacent tiles, undoing RemoveWalls
+func AddWalls(tile1 *Tile, tile2 *Tile) {
+	setWalls(tile1, tile2, true)
+}
+
+// setWalls keeps both tiles' flags for the wall between them in step
+func setWalls(tile1 *Tile, tile2 *Tile, present bool) {
+	topo := tile1.Topology()
+	tile1.SetWall(topo.Side(tile1, tile2), present)
+	tile2.SetWall(topo.Side(tile2, tile1), present)
+}
+
+// HasWall reports whether there is a wall between two adjacent tiles
+func HasWall(tile1 *Tile, tile2 *Tile) bool {
+	return tile1.Wall(tile1.Topology().Side(tile1, tile2))
+}
+
+// Across returns the tile on the other side of t's side, or nil if a wall or the edge of the grid is in the way
+func Across(grid Grid, t *Tile, side int) *Tile {
+	topo := t.Topology()
+	if side >= topo.Sides(t) || t.Wall(side) {
+		return nil
+	}
+
+	row, col := topo.Neighbour(t, side)
+	if row < 0 || row >= len(grid) || col < 0 || col >= len(grid[row]) {
+		return nil
+	}
+
+	return grid[row][col]
+}
+
+// Step returns the tile one row/col step away from t, or nil if a wall or the edge of the grid is in the way.
+// Moves that do not cross a single side of t, like diagonals on a square grid, are never open.
+func Step(grid Grid, t *Tile, dRow, dCol int) *Tile {
+	topo := t.Topology()
+	for side := range topo.Sides(t) {
+		if row, col := topo.Neighbour(t, side); row == t.Row+dRow && col == t.Col+dCol {
+			return Across(grid, t, side)
 		}
 	}
 
-	*walls.frontierWall = false
-	*walls.visitedWall = false
+	return nil
 }
@@ -0,0 +1,39 @@
+package utils
+
+// Validity describes how far a grid is from a perfect maze, where there is exactly one route between any two tiles
+type Validity struct {
+	// Regions is how many separate areas the grid falls into, 1 when every tile can reach every other
+	Regions int
+	// Loops is how many passages could be walled up again without cutting anything off
+	Loops int
+}
+
+func (v Validity) Perfect() bool {
+	return v.Regions == 1 && v.Loops == 0
+}
+
+// Validate counts regions and loops. A connected set of n tiles needs n-1 passages to join it up,
+// so every passage beyond that closes a loop.
+func Validate(grid Grid) Validity {
+	if grid.Size() == 0 {
+		return Validity{}
+	}
+
+	uf := NewUnionFind(grid)
+	topo := grid.Topology()
+	passages := 0
+	for _, row := range grid {
+		for _, t := range row {
+			// only look forward so each passage is counted once
+			for _, side := range topo.Forward(t) {
+				if next := Across(grid, t, side); next != nil {
+					uf.Union(t, next)
+					passages++
+				}
+			}
+		}
+	}
+
+	regions := uf.CountSets()
+	return Validity{Regions: regions, Loops: passages - (grid.Size() - regions)}
+}
@@ -0,0 +1,49 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/bailey4770/gomazing/generators/dfs"
+	"github.com/bailey4770/gomazing/utils"
+	"github.com/bailey4770/gomazing/utils/mazetest"
+)
+
+func TestValidate(t *testing.T) {
+	utils.Seed(7)
+	grid := utils.NewGrid(6, 7)
+
+	if v := utils.Validate(grid); v.Regions != grid.Size() || v.Loops != 0 {
+		t.Fatalf("expected every tile walled off alone but got %+v", v)
+	}
+
+	mazetest.Generate(t, dfs.GetMazeState(), grid)
+	if v := utils.Validate(grid); !v.Perfect() {
+		t.Fatalf("expected a generated maze to be perfect but got %+v", v)
+	}
+
+	// find a wall still standing and a passage between east-west neighbours
+	var a, b, c, d *utils.Tile
+	for _, row := range grid {
+		for _, tile := range row[:len(row)-1] {
+			east := row[tile.Col+1]
+			if utils.HasWall(tile, east) {
+				a, b = tile, east
+			} else {
+				c, d = tile, east
+			}
+		}
+	}
+
+	// knocking through the wall makes a loop
+	utils.RemoveWalls(a, b)
+	if v := utils.Validate(grid); v.Regions != 1 || v.Loops != 1 {
+		t.Fatalf("expected one loop after removing a wall but got %+v", v)
+	}
+
+	// walling the same passage up again plus one more cuts the maze in two
+	utils.AddWalls(a, b)
+	utils.AddWalls(c, d)
+	if v := utils.Validate(grid); v.Regions != 2 || v.Loops != 0 {
+		t.Fatalf("expected two regions after walling a passage but got %+v", v)
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+// Visible calls visit for every tile the player at from can see: tiles within radius steps along open
+// passages, plus every tile down a straight corridor out of each side. from is always visible.
+func Visible(grid Grid, from *Tile, radius int, visit func(*Tile)) {
+	seen := map[*Tile]bool{from: true}
+	visit(from)
+
+	see := func(t *Tile) {
+		if !seen[t] {
+			seen[t] = true
+			visit(t)
+		}
+	}
+
+	// straight lines of sight keep leaving by the same side and stop at the first wall. Going round a polar
+	// ring comes back to from when nothing is in the way, so they also stop at anything already seen.
+	topo := from.Topology()
+	for side := range topo.Sides(from) {
+		for t := Across(grid, from, side); t != nil && !seen[t]; t = Across(grid, t, side) {
+			see(t)
+		}
+	}
+
+	// breadth first through open walls, so the radius is measured in steps not straight distance
+	queue := []*Tile{from}
+	dist := map[*Tile]int{from: 0}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if dist[t] == radius {
+			continue
+		}
+
+		for side := range topo.Sides(t) {
+			next := Across(grid, t, side)
+			if next == nil {
+				continue
+			}
+			if _, ok := dist[next]; ok {
+				continue
+			}
+			dist[next] = dist[t] + 1
+			see(next)
+			queue = append(queue, next)
+		}
+	}
+}
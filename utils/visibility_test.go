@@ -0,0 +1,30 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/bailey4770/gomazing/utils"
+)
+
+func TestVisibleOpenPolarRing(t *testing.T) {
+	grid := utils.NewGridOf(utils.Polar, 3, 0)
+	ring := grid[1]
+	for i, tile := range ring {
+		utils.RemoveWalls(tile, ring[(i+1)%len(ring)])
+	}
+
+	// looking round the open ring comes back to where it started, which has to end the line of sight
+	seen := map[*utils.Tile]int{}
+	utils.Visible(grid, ring[0], 0, func(t *utils.Tile) {
+		seen[t]++
+	})
+
+	if len(seen) != len(ring) {
+		t.Fatalf("expected all %d tiles of the open ring to be visible but got %d", len(ring), len(seen))
+	}
+	for tile, n := range seen {
+		if tile.Row != 1 || n != 1 {
+			t.Fatalf("expected each tile of ring 1 visited once but (%d, %d) was visited %d times", tile.Row, tile.Col, n)
+		}
+	}
+}